@@ -33,6 +33,10 @@ func (p PrivateKey) Public() ed25519.PublicKey {
 	return k.(ed25519.PublicKey)
 }
 
+func (p PrivateKey) Ed25519() ed25519.PrivateKey {
+	return p.key
+}
+
 func (p PrivateKey) EncodePEM(w io.Writer) (err error) {
 	return pem.Encode(w, &pem.Block{
 		Type:  privKeyBlockType,
@@ -0,0 +1,43 @@
+package logger
+
+import (
+	"context"
+	"time"
+
+	"github.com/kpango/fastime"
+)
+
+// Provides the current time for new entries. Satisfied by `fastime.Fastime`.
+type Clock interface {
+	Now() time.Time
+}
+
+// Returns a clock with the requested precision. Precisions of a millisecond or coarser are
+// served by a cached clock that ticks at that interval until the context is cancelled, while
+// finer precisions read the wall clock directly. Default: time.Second
+func NewClock(ctx context.Context, precision time.Duration) Clock {
+	if precision <= 0 {
+		precision = time.Second
+	}
+
+	if precision < time.Millisecond {
+		return wallClock{}
+	}
+
+	return fastime.New().StartTimerD(ctx, precision)
+}
+
+type wallClock struct{}
+
+func (wallClock) Now() time.Time {
+	return time.Now()
+}
+
+// Returns the sub-second part of a timestamp in nanoseconds, truncated to a precision.
+func subSecond(t time.Time, precision time.Duration) uint32 {
+	if precision >= time.Second {
+		return 0
+	}
+
+	return uint32(time.Duration(t.Nanosecond()).Truncate(precision))
+}
@@ -0,0 +1,58 @@
+package logger
+
+import "context"
+
+type loggerContextKey struct{}
+
+type fieldsContextKey struct{}
+
+// Request-scoped fields carried by a context, merged into loggers by `Logger.Ctx`.
+type contextFields struct {
+	tags        []any
+	metaKeys    []string
+	metaValues  []any
+	categoryId  uint8
+	hasCategory bool
+}
+
+// Returns a copy of the context carrying the logger, e.g. to pass a request-scoped logger
+// through handlers. Retrieve it with `FromContext`.
+func WithContext(ctx context.Context, l *Logger) context.Context {
+	return context.WithValue(ctx, loggerContextKey{}, l)
+}
+
+// Returns the logger carried by the context, if any.
+func FromContext(ctx context.Context) (l *Logger, ok bool) {
+	l, ok = ctx.Value(loggerContextKey{}).(*Logger)
+	return
+}
+
+// Returns a copy of the context carrying tags, which will be added to loggers by `Logger.Ctx`.
+func ContextWithTags(ctx context.Context, tags ...any) context.Context {
+	f := fieldsFromContext(ctx)
+	f.tags = append(f.tags[:len(f.tags):len(f.tags)], tags...)
+	return context.WithValue(ctx, fieldsContextKey{}, f)
+}
+
+// Returns a copy of the context carrying meta, which will be added to loggers by `Logger.Ctx`.
+func ContextWithMeta(ctx context.Context, key string, value any) context.Context {
+	f := fieldsFromContext(ctx)
+	f.metaKeys = append(f.metaKeys[:len(f.metaKeys):len(f.metaKeys)], key)
+	f.metaValues = append(f.metaValues[:len(f.metaValues):len(f.metaValues)], value)
+	return context.WithValue(ctx, fieldsContextKey{}, f)
+}
+
+// Returns a copy of the context carrying a category ID, which will be set on loggers by `Logger.Ctx`.
+func ContextWithCategory(ctx context.Context, categoryId uint8) context.Context {
+	f := fieldsFromContext(ctx)
+	f.categoryId = categoryId
+	f.hasCategory = true
+	return context.WithValue(ctx, fieldsContextKey{}, f)
+}
+
+// Returns the fields carried by the context. Their slices must be capped before appending,
+// so that the fields of a parent context are never modified.
+func fieldsFromContext(ctx context.Context) contextFields {
+	f, _ := ctx.Value(fieldsContextKey{}).(contextFields)
+	return f
+}
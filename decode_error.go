@@ -0,0 +1,75 @@
+package logger
+
+import (
+	"strconv"
+)
+
+// Sections of an encoded entry that aren't levels
+const (
+	sectionSize        = "size"
+	sectionChecksum    = "checksum"
+	sectionSignature   = "signature"
+	sectionFingerprint = "fingerprint"
+)
+
+var levelNames = [_End_Level]string{
+	_0_BucketId:     "bucket ID",
+	_1_EntryId:      "entry ID",
+	_2_Severity:     "severity",
+	_3_Message:      "message",
+	_4_CategoryId:   "category ID",
+	_5_Tags:         "tags",
+	_6_Metric:       "metrics",
+	_7_Meta:         "meta",
+	_8_Stack_trace:  "stack trace",
+	_9_TTL_Entry:    "entry TTL",
+	_10_TTL_Meta:    "meta TTL",
+	_11_Timestamp:   "timestamp",
+	_12_Correlation: "correlation",
+	_13_Truncation:  "truncation",
+}
+
+// Implements stringer interface
+func (l level) String() string {
+	if l < _End_Level {
+		return levelNames[l]
+	}
+
+	return "level " + strconv.Itoa(int(l))
+}
+
+// Returned when an entry can't be decoded, with details about where it failed. Wraps one of
+// `ErrTooShort`, `ErrCorruptEntry`, `ErrChecksumMismatch` or `ErrInvalidUTF8`, so that it can
+// be checked with `errors.Is`.
+type DecodeError struct {
+	Err      error
+	Section  string // E.g. "tags", "meta" or "stack trace"
+	Offset   int    // Byte offset in the encoded entry where the section failed
+	Expected int    // Expected length, offset or value - depending on what failed
+	Actual   int    // Actual length, offset or value - depending on what failed
+}
+
+func decodeError(err error, section string, offset, expected, actual int) *DecodeError {
+	return &DecodeError{
+		Err:      err,
+		Section:  section,
+		Offset:   offset,
+		Expected: expected,
+		Actual:   actual,
+	}
+}
+
+// Implements error interface
+func (err *DecodeError) Error() string {
+	msg := err.Err.Error() + ": " + err.Section + " at offset " + strconv.Itoa(err.Offset)
+
+	if err.Expected != err.Actual {
+		msg += " (expected " + strconv.Itoa(err.Expected) + ", got " + strconv.Itoa(err.Actual) + ")"
+	}
+
+	return msg
+}
+
+func (err *DecodeError) Unwrap() error {
+	return err.Err
+}
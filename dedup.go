@@ -0,0 +1,173 @@
+package logger
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Max number of unique entries tracked by a deduplicator. When exceeded, all collapsed duplicates
+// are sent and tracking starts over.
+const MaxDedupKeys = 4096
+
+// Collapses identical entries (same message template, tags and category) within a time window.
+// The first entry is sent immediately, and any duplicates of it within the window are collapsed
+// into the last of them, which is sent when the window closes with an `occurrences` metric (the
+// number of collapsed duplicates) and `first_seen` / `last_seen` meta (when the first entry and
+// the last duplicate were created). Set on a logger with `Logger.Dedup`, and can be shared between
+// loggers. Collapsed duplicates are also sent when the pool is flushed or closed.
+type Deduplicator struct {
+	entries map[string]*duplicate
+	queue   []*duplicate // In order of expiry
+	timer   *time.Timer  // Armed for the first duplicate in the queue
+	window  time.Duration
+	mu      sync.Mutex
+}
+
+type duplicate struct {
+	entry     *Entry // Copy of the last duplicate, sent when the window closes
+	pool      *Pool
+	key       string
+	expires   time.Time
+	firstSeen time.Time
+	lastSeen  time.Time
+	count     int64
+}
+
+// Creates a deduplicator that collapses identical entries within the window.
+func NewDeduplicator(window time.Duration) *Deduplicator {
+	return &Deduplicator{
+		entries: make(map[string]*duplicate),
+		window:  window,
+	}
+}
+
+// Sends all collapsed duplicates without waiting for their windows to close.
+func (d *Deduplicator) Flush() {
+	d.mu.Lock()
+	queue := d.reset()
+	d.mu.Unlock()
+
+	for _, dup := range queue {
+		dup.send()
+	}
+}
+
+// Returns whether the entry should be sent. Duplicates are copied and kept until the window closes,
+// so the entry itself isn't retained.
+func (d *Deduplicator) add(e *Entry) bool {
+	key := dedupKey(e)
+	pool := e.logger.pool
+	now := pool.opt.Clock.Now()
+
+	d.mu.Lock()
+
+	if dup, ok := d.entries[key]; ok {
+		if dup.entry == nil {
+			dup.entry = new(Entry)
+		}
+
+		dup.entry.copyFrom(e)
+		dup.lastSeen = now
+		dup.count++
+		d.mu.Unlock()
+		return false
+	}
+
+	var flushed []*duplicate
+
+	if len(d.entries) >= MaxDedupKeys {
+		flushed = d.reset()
+	}
+
+	dup := &duplicate{
+		pool:      pool,
+		key:       key,
+		expires:   time.Now().Add(d.window),
+		firstSeen: now,
+	}
+
+	d.entries[key] = dup
+	d.queue = append(d.queue, dup)
+
+	if len(d.queue) == 1 {
+		if d.timer == nil {
+			d.timer = time.AfterFunc(d.window, d.expire)
+		} else {
+			d.timer.Reset(d.window)
+		}
+	}
+
+	d.mu.Unlock()
+
+	for _, dup := range flushed {
+		dup.send()
+	}
+
+	return true
+}
+
+// Stops tracking all entries, and returns them. Must be called with the mutex locked.
+func (d *Deduplicator) reset() (queue []*duplicate) {
+	queue = d.queue
+	d.queue = nil
+	d.entries = make(map[string]*duplicate)
+	return
+}
+
+// Sends all duplicates whose window has closed, and rearms the timer for the next one.
+func (d *Deduplicator) expire() {
+	now := time.Now()
+	d.mu.Lock()
+	n := 0
+
+	for n < len(d.queue) && !d.queue[n].expires.After(now) {
+		delete(d.entries, d.queue[n].key)
+		n++
+	}
+
+	expired := d.queue[:n:n]
+	d.queue = d.queue[n:]
+
+	if len(d.queue) != 0 {
+		d.timer.Reset(d.queue[0].expires.Sub(now))
+	}
+
+	d.mu.Unlock()
+
+	for _, dup := range expired {
+		dup.send()
+	}
+}
+
+func (dup *duplicate) send() {
+	e := dup.entry
+
+	if e == nil || dup.pool.closed.Load() {
+		return
+	}
+
+	e.Counter("occurrences", dup.count)
+	e.Meta("first_seen", dup.firstSeen.Format(time.RFC3339Nano))
+	e.Meta("last_seen", dup.lastSeen.Format(time.RFC3339Nano))
+
+	// The logger's context has already been appended. The caller's context might be done by now,
+	// so it's not used.
+	dup.pool.client.ProcessEntry(context.Background(), e)
+}
+
+func dedupKey(e *Entry) string {
+	var b strings.Builder
+	b.WriteString(strconv.Itoa(int(e.categoryId)))
+	b.WriteByte(0)
+	b.WriteString(e.message)
+
+	for i := uint8(0); i < e.tagsCount; i++ {
+		b.WriteByte(0)
+		b.WriteString(e.tags[i])
+	}
+
+	return b.String()
+}
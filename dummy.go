@@ -7,7 +7,7 @@ import (
 	"github.com/kpango/fastime"
 )
 
-var _ Client = (*dummyWriter)(nil)
+var _ ClientLifecycle = (*dummyWriter)(nil)
 
 type dummyWriter struct {
 	clock fastime.Fastime
@@ -23,6 +23,14 @@ func (w *dummyWriter) ProcessEntry(_ context.Context, _ *Entry) (err error) {
 	return
 }
 
+func (w *dummyWriter) Flush(_ context.Context) (err error) {
+	return
+}
+
+func (w *dummyWriter) Close(_ context.Context) (err error) {
+	return
+}
+
 func (w *dummyWriter) Now() time.Time {
 	return w.clock.Now()
 }
@@ -2,12 +2,14 @@ package logger
 
 import (
 	"context"
+	"crypto/ed25519"
 	"encoding"
 	"encoding/binary"
+	"hash/crc32"
 	"math"
 	"runtime"
-	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/rs/xid"
 )
@@ -17,8 +19,12 @@ import (
 		4 byte (uint32) integer
 	1. EntryId
 		12 byte XID
-	2. Severity
-		1 byte
+	2. Severity and flags
+		1 byte, where the lower 3 bits are the severity and the upper bits are flags:
+			0x80: CRC32C trailer
+			0x40: Ed25519 signature trailer
+			0x20: Attachment chunk (see entry_attachment.go)
+			0x10: Fingerprint trailer (see entry_fingerprint.go)
 	3. Message
 		1 byte (uint8) length (X)
 		X bytes string
@@ -32,7 +38,16 @@ import (
 		1 byte (uint8) count (0-32)
 			1 byte (uint8) length (X)
 			X bytes string key
-			2 bytes (int16) value
+			1 byte kind (high nibble) and type (low nibble)
+			1 byte (uint8) unit length (U)
+			U bytes string unit
+			Integer and float:
+				8 bytes (int64 / float64) value
+			Histogram:
+				1 byte (uint8) bucket count (0-16)
+					8 bytes (float64) upper bound
+					4 bytes (uint32) count
+				[...15]
 		[...31]
 	7. Meta
 		1 byte (uint8) count (0-32)
@@ -42,15 +57,31 @@ import (
 			Y bytes string value
 		[...31]
 	8. Stack trace
-		1 byte (uint8) count (0-8)
+		1 byte (uint8) count (0-16)
 			1 byte (uint8) path length (X)
 			X bytes string path
-			2 bytes (uint16) line number
-		[...]
+			1 byte (uint8) function length (Y)
+			Y bytes string function
+			4 bytes (uint32) line number
+		[...15]
 	9. TTL: Entry
 		2 byte (uint16) days
 	10. TTL: Meta
 		2 byte (uint16) days
+	11. Timestamp
+		4 bytes (uint32) nanoseconds since the second of the entry ID
+	12. Correlation
+		16 bytes W3C trace ID
+		8 bytes W3C span ID
+		1 byte W3C trace flags
+		12 bytes XID of parent entry
+	13. Truncation
+		2 bytes (uint16) bitmask of fields that were truncated or dropped (see entry_truncation.go)
+
+	Trailers (present if flagged, after the last level)
+		8 bytes (uint64) fingerprint
+		64 bytes Ed25519 signature of all preceding bytes, including the size annotation
+		4 bytes (uint32) CRC32C of all preceding bytes, including the size annotation
 
 */
 
@@ -63,12 +94,19 @@ const (
 	MaxTagSize            = math.MaxUint8
 	MaxMetaValueSize      = math.MaxUint16
 	MaxStackTracePathSize = math.MaxUint8
+	MaxStackTraceFuncSize = math.MaxUint8
+	MaxMetricUnitSize     = math.MaxUint8
 	MaxMetaCount          = 32
 	MaxMetricCount        = 32
 	MaxStackTraceCount    = 16
 	MaxTagsCount          = 8
+	MaxHistogramBuckets   = 16
 )
 
+// Size of the fixed-size levels after the stack trace, that are reserved when dropping
+// metrics, meta and stack frames that don't fit
+const fixedTailSize = 2 + 2 + 4 + 37 + 2
+
 const (
 	_0_BucketId level = iota
 	_1_EntryId
@@ -81,72 +119,79 @@ const (
 	_8_Stack_trace
 	_9_TTL_Entry
 	_10_TTL_Meta
+	_11_Timestamp
+	_12_Correlation
+	_13_Truncation
 	_End_Level
 )
 
+// Flags stored in the upper bits of the severity byte
+const (
+	severityMask    = 0x07
+	flagChecksum    = 0x80
+	flagSignature   = 0x40
+	flagAttachment  = 0x20
+	flagFingerprint = 0x10
+	knownFlags      = flagChecksum | flagSignature | flagAttachment | flagFingerprint
+)
+
 // Entry implements these interfaces
 var (
-	_ stringer                   = Entry{}
-	_ error                      = Entry{}
-	_ encoding.BinaryMarshaler   = Entry{}
-	_ encoding.BinaryUnmarshaler = (*Entry)(nil)
+	_ stringer                    = Entry{}
+	_ error                       = Entry{}
+	_ interface{ Unwrap() error } = Entry{}
+	_ encoding.BinaryMarshaler    = Entry{}
+	_ encoding.BinaryUnmarshaler  = (*Entry)(nil)
 )
 
 type Entry struct {
 	metaKeys        [MaxMetaCount]string
 	metaValues      [MaxMetaCount]string
 	metricKeys      [MaxMetricCount]string
-	metricValues    [MaxMetricCount]int32
+	metricValues    [MaxMetricCount]MetricValue
 	stackTracePaths [MaxStackTraceCount]string
-	stackTraceLines [MaxStackTraceCount]uint16
+	stackTraceFuncs [MaxStackTraceCount]string
+	stackTraceLines [MaxStackTraceCount]uint32
 	tags            [MaxTagsCount]string
+	attachKeys      [MaxAttachmentCount]string
+	attachValues    [MaxAttachmentCount]string
+	signature       [ed25519.SignatureSize]byte
+	histBounds      []float64 // Backing storage for decoded histograms
+	histCounts      []uint32  // Backing storage for decoded histograms
 	message         string
+	traceCtx        TraceContext
+	cause           error
 	id              xid.ID
+	parentId        xid.ID
+	fingerprint     uint64 // Transmitted fingerprint of a decoded entry
 	logger          *Logger
+	resource        *Resource
 	bucketId        uint32
+	nanos           uint32
 	ttlEntry        uint16
 	ttlMeta         uint16
+	truncated       Truncation
 	severity        Severity
+	flags           uint8
 	level           level
 	categoryId      uint8
 	tagsCount       uint8
 	metaCount       uint8
 	metricCount     uint8
 	stackTraceCount uint8
+	attachCount     uint8
+	noop            bool
+	recheck         bool // Whether level rules must be consulted again when sent, see `Logger.admits`
 }
 
 var nilId xid.ID
 
-// Implements stringer interface
-func (e Entry) String() string {
-	var (
-		builder strings.Builder
-		tagIdx  uint8
-		i       uint8
-	)
-
-	strLen := uint8(len(e.message))
-
-	for i = 0; i < strLen; i++ {
-		if e.message[i] == '%' && int(i+1) < len(e.message) {
-			if e.message[i+1] == '%' {
-				builder.WriteByte('%')
-				i++ // Skip the second '%'
-			} else {
-				if tagIdx < e.tagsCount {
-					builder.WriteString(e.tags[tagIdx])
-					tagIdx++
-					i++ // Skip the placeholder
-				} else {
-					builder.WriteByte('%')
-				}
-			}
-		} else {
-			builder.WriteByte(e.message[i])
-		}
-	}
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
 
-	return builder.String()
+// Implements stringer interface. Renders the message with its placeholders replaced by tags
+// and meta, e.g. "%d" and "{user}".
+func (e Entry) String() string {
+	return formatMessage(&e)
 }
 
 // Implements error interface
@@ -158,21 +203,49 @@ func (e Entry) Error() string {
 func (e *Entry) Reset() {
 	e.id = nilId
 	e.logger = nil
+	e.resource = nil
 	e.level = _3_Message
+	e.flags = 0
+	e.fingerprint = 0
 	e.tagsCount = 0
 	e.metricCount = 0
 	e.metaCount = 0
 	e.stackTraceCount = 0
+	e.attachCount = 0
+	e.categoryId = 0
+	e.recheck = false
+	e.histBounds = e.histBounds[:0]
+	e.histCounts = e.histCounts[:0]
 	e.ttlEntry = 0
 	e.ttlMeta = 0
+	e.nanos = 0
+	e.traceCtx = TraceContext{}
+	e.parentId = nilId
+	e.truncated = 0
+	e.cause = nil
 }
 
 // Encodes the entry to a binary representation into b. If b isn't
 // large enought we will panic. Returns number of bytes written.
 func (e *Entry) Encode(b []byte) (s int) {
+	return e.encode(b, nil)
+}
+
+// Encodes the entry like `Encode`, and signs it with an Ed25519 private key. The signature
+// is kept in the entry, so that it's retained if the entry is encoded again.
+func (e *Entry) EncodeSigned(b []byte, key ed25519.PrivateKey) (s int) {
+	e.flags |= flagSignature
+	e.incLevel(_2_Severity)
+	return e.encode(b, key)
+}
+
+func (e *Entry) encode(b []byte, key ed25519.PrivateKey) (s int) {
 	var i uint8
 	var l level
 
+	// Reserve space for any trailers, and the levels after any dropped fields
+	limit := MaxEntrySize - e.trailerSize() - fixedTailSize
+
 	// Reserve two bytes for the size annotation
 	s += 2
 
@@ -187,7 +260,7 @@ func (e *Entry) Encode(b []byte) (s int) {
 			s += copy(b[s:], e.id[:])
 
 		case _2_Severity:
-			b[s] = uint8(e.severity)
+			b[s] = uint8(e.severity)&severityMask | e.flags
 			s++
 
 		case _3_Message:
@@ -213,21 +286,43 @@ func (e *Entry) Encode(b []byte) (s int) {
 			b[s] = e.metricCount
 			s++
 			for i = 0; i < e.metricCount; i++ {
-				keyLen := len(e.stackTracePaths[i])
+				keyLen := len(e.metricKeys[i])
+				v := &e.metricValues[i]
 
-				if s+keyLen+5 > MaxEntrySize {
+				if s+keyLen+1+v.size() > limit {
 					b[pos] = i
+					e.setTruncated(DroppedMetrics)
 					break
 				}
 
 				b[s] = uint8(keyLen)
 				s++
 				s += copy(b[s:], e.metricKeys[i])
-				b[s] = byte(e.metricValues[i] >> 24)
-				b[s+1] = byte(e.metricValues[i] >> 16)
-				b[s+2] = byte(e.metricValues[i] >> 8)
-				b[s+3] = byte(e.metricValues[i])
-				s += 4
+				b[s] = uint8(v.Kind)<<4 | uint8(v.Type)&0x0f
+				s++
+				b[s] = uint8(len(v.Unit))
+				s++
+				s += copy(b[s:], v.Unit)
+
+				switch v.Type {
+				case FloatMetric:
+					binary.BigEndian.PutUint64(b[s:], math.Float64bits(v.Float))
+					s += 8
+
+				case HistogramMetric:
+					n := v.Histogram.Len()
+					b[s] = uint8(n)
+					s++
+					for j := 0; j < n; j++ {
+						binary.BigEndian.PutUint64(b[s:], math.Float64bits(v.Histogram.Bounds[j]))
+						binary.BigEndian.PutUint32(b[s+8:], v.Histogram.Counts[j])
+						s += 12
+					}
+
+				default:
+					binary.BigEndian.PutUint64(b[s:], uint64(v.Int))
+					s += 8
+				}
 			}
 
 		case _7_Meta:
@@ -238,8 +333,9 @@ func (e *Entry) Encode(b []byte) (s int) {
 				keyLen := len(e.metaKeys[i])
 				valLen := len(e.metaValues[i])
 
-				if s+keyLen+valLen+3 > MaxEntrySize {
+				if s+keyLen+valLen+3 > limit {
 					b[pos] = i
+					e.setTruncated(DroppedMeta)
 					break
 				}
 
@@ -259,18 +355,22 @@ func (e *Entry) Encode(b []byte) (s int) {
 			s++
 			for i = 0; i < e.stackTraceCount; i++ {
 				pathLen := len(e.stackTracePaths[i])
+				funcLen := len(e.stackTraceFuncs[i])
 
-				if s+pathLen+3 > MaxEntrySize {
+				if s+pathLen+funcLen+6 > limit {
 					b[pos] = i
+					e.setTruncated(DroppedStackTrace)
 					break
 				}
 
 				b[s] = uint8(pathLen)
 				s++
 				s += copy(b[s:], e.stackTracePaths[i])
-				b[s] = byte(e.stackTraceLines[i] >> 8)
-				b[s+1] = byte(e.stackTraceLines[i])
-				s += 2
+				b[s] = uint8(funcLen)
+				s++
+				s += copy(b[s:], e.stackTraceFuncs[i])
+				binary.BigEndian.PutUint32(b[s:], e.stackTraceLines[i])
+				s += 4
 			}
 
 		case _9_TTL_Entry:
@@ -280,43 +380,137 @@ func (e *Entry) Encode(b []byte) (s int) {
 		case _10_TTL_Meta:
 			binary.BigEndian.PutUint16(b[s:], e.ttlMeta)
 			s += 2
+
+		case _11_Timestamp:
+			binary.BigEndian.PutUint32(b[s:], e.nanos)
+			s += 4
+
+		case _12_Correlation:
+			s += copy(b[s:], e.traceCtx.TraceId[:])
+			s += copy(b[s:], e.traceCtx.SpanId[:])
+			b[s] = e.traceCtx.Flags
+			s++
+			s += copy(b[s:], e.parentId[:])
+
+		case _13_Truncation:
+			binary.BigEndian.PutUint16(b[s:], uint16(e.truncated))
+			s += 2
+		}
+	}
+
+	// Trailers cover the final size annotation, so it must be written first
+	binary.BigEndian.PutUint16(b, uint16(s+e.trailerSize()))
+
+	if e.flags&flagFingerprint != 0 {
+		binary.BigEndian.PutUint64(b[s:], e.Fingerprint())
+		s += fingerprintSize
+	}
+
+	if e.flags&flagSignature != 0 {
+		if key != nil {
+			copy(e.signature[:], ed25519.Sign(key, b[:s]))
 		}
+
+		s += copy(b[s:], e.signature[:])
+	}
+
+	if e.flags&flagChecksum != 0 {
+		binary.BigEndian.PutUint32(b[s:], crc32.Checksum(b[:s], crcTable))
+		s += 4
+	}
+
+	return
+}
+
+func (e *Entry) trailerSize() (size int) {
+	if e.flags&flagFingerprint != 0 {
+		size += fingerprintSize
+	}
+
+	if e.flags&flagSignature != 0 {
+		size += ed25519.SignatureSize
 	}
 
-	binary.BigEndian.PutUint16(b, uint16(s))
+	if e.flags&flagChecksum != 0 {
+		size += 4
+	}
 
 	return
 }
 
 // Decodes a binary representation into entry, with an option to reference to the
-// byte slice directly instead of doing any copy.
+// byte slice directly instead of doing any copy. Returns a `*DecodeError` on failure.
 func (e *Entry) Decode(b []byte, noCopy ...bool) (err error) {
-	e.Reset()
+	return e.decode(b, noCopy != nil && noCopy[0], false, false)
+}
 
-	var unsafe bool
+// Decodes like `Decode`, but also rejects out-of-range values (e.g. severity and metric kinds)
+// and strings that aren't valid UTF-8.
+func (e *Entry) DecodeStrict(b []byte, noCopy ...bool) (err error) {
+	return e.decode(b, noCopy != nil && noCopy[0], true, false)
+}
 
-	if noCopy != nil && noCopy[0] {
-		unsafe = true
-	}
+func (e *Entry) decode(b []byte, unsafe bool, strict bool, legacy bool) (err error) {
+	e.Reset()
 
 	// An entry must contain at least size annotation (2 bytes), bucket ID (4 bytes) and entry ID (12 bytes)
 	if len(b) < 18 {
-		return ErrTooShort
+		return decodeError(ErrTooShort, sectionSize, 0, 18, len(b))
 	}
 
-	var s uint16
+	var s int
 
 	// Existence of size annotation is already ensured. And this can't overflow as the annotation
 	// is an uint16, which can't store an integer larger than 2^16, which is the max length of an entry.
-	total := binary.BigEndian.Uint16(b[s:])
+	total := int(binary.BigEndian.Uint16(b[s:]))
 	s += 2
 
-	if uint16(len(b)) != total {
-		return ErrCorruptEntry
+	if len(b) != total {
+		return decodeError(ErrCorruptEntry, sectionSize, 0, total, len(b))
+	}
+
+	// Flags are stored in the severity byte, if any. Legacy entries have no flags, nor any levels
+	// after the TTLs.
+	endLevel := _End_Level
+
+	if legacy {
+		endLevel = _11_Timestamp
+	} else if total > 18 {
+		e.flags = b[18] &^ severityMask
+	}
+
+	// Verify and strip any trailers
+	if e.flags&flagChecksum != 0 {
+		if total < 23 {
+			return decodeError(ErrTooShort, sectionChecksum, total, 23, total)
+		}
+
+		total -= 4
+
+		if crc32.Checksum(b[:total], crcTable) != binary.BigEndian.Uint32(b[total:]) {
+			return decodeError(ErrChecksumMismatch, sectionChecksum, total, 0, 0)
+		}
+	}
+
+	if e.flags&flagSignature != 0 {
+		if total < 19+ed25519.SignatureSize {
+			return decodeError(ErrTooShort, sectionSignature, total, 19+ed25519.SignatureSize, total)
+		}
+
+		total -= ed25519.SignatureSize
+		copy(e.signature[:], b[total:])
+	}
+
+	if e.flags&flagFingerprint != 0 {
+		if total < 19+fingerprintSize {
+			return decodeError(ErrTooShort, sectionFingerprint, total, 19+fingerprintSize, total)
+		}
+
+		total -= fingerprintSize
+		e.fingerprint = binary.BigEndian.Uint64(b[total:])
 	}
 
-loop:
-	for e.level = 0; e.level < _End_Level; e.level++ {
+	for e.level = 0; e.level < endLevel; e.level++ {
 		switch e.level {
 
 		// Existence of bucket ID is already ensured
@@ -327,24 +521,39 @@ loop:
 		// Existence of entry ID is already ensured
 		case _1_EntryId:
 			if e.id, err = xid.FromBytes(b[s : s+12]); err != nil {
-				return
+				return decodeError(err, e.level.String(), s, 12, 12)
 			}
 
 			s += 12
 
 		// Only one byte, can't be out of range
 		case _2_Severity:
-			e.severity = Severity(b[s])
+			e.severity = Severity(b[s] & severityMask)
+
+			allowed := uint8(severityMask | knownFlags)
+
+			if legacy {
+				allowed = severityMask
+			}
+
+			if strict && b[s]&^allowed != 0 {
+				return decodeError(ErrCorruptEntry, e.level.String(), s, int(allowed), int(b[s]))
+			}
+
 			s++
 
 		// Message length is dynamic and must not be out of range
 		case _3_Message:
-			size := uint16(b[s])
+			size := int(b[s])
 			s++
 
 			// Out of range?
 			if s+size > total {
-				break loop
+				return decodeError(ErrCorruptEntry, e.level.String(), s, s+size, total)
+			}
+
+			if strict && !utf8.Valid(b[s:s+size]) {
+				return decodeError(ErrInvalidUTF8, e.level.String(), s, 0, 0)
 			}
 
 			e.message = toString(b[s:s+size], unsafe)
@@ -358,27 +567,32 @@ loop:
 		// Tags count and length are dynamic and must not be out of range
 		case _5_Tags:
 			e.tagsCount = b[s]
-			s++
 
 			// Out of range?
 			if e.tagsCount > MaxTagsCount {
-				break loop
+				return decodeError(ErrCorruptEntry, e.level.String(), s, MaxTagsCount, int(e.tagsCount))
 			}
 
+			s++
+
 			var i uint8
 			for i = 0; i < e.tagsCount; i++ {
 
 				// Out of range?
 				if s >= total {
-					break loop
+					return decodeError(ErrCorruptEntry, e.level.String(), s, s+1, total)
 				}
 
-				size := uint16(b[s])
+				size := int(b[s])
 				s++
 
 				// Out of range?
 				if s+size > total {
-					break loop
+					return decodeError(ErrCorruptEntry, e.level.String(), s, s+size, total)
+				}
+
+				if strict && !utf8.Valid(b[s:s+size]) {
+					return decodeError(ErrInvalidUTF8, e.level.String(), s, 0, 0)
 				}
 
 				e.tags[i] = toString(b[s:s+size], unsafe)
@@ -387,72 +601,161 @@ loop:
 
 		// Metric count and length are dynamic and must not be out of range
 		case _6_Metric:
+			if legacy {
+				if s, err = e.decodeLegacyMetrics(b, s, total, unsafe, strict); err != nil {
+					return
+				}
+
+				break
+			}
+
 			e.metricCount = b[s]
-			s++
 
 			// Out of range?
 			if e.metricCount > MaxMetricCount {
-				break loop
+				return decodeError(ErrCorruptEntry, e.level.String(), s, MaxMetricCount, int(e.metricCount))
 			}
 
+			s++
+
 			var i uint8
 			for i = 0; i < e.metricCount; i++ {
 
 				// Out of range?
 				if s >= total {
-					break loop
+					return decodeError(ErrCorruptEntry, e.level.String(), s, s+1, total)
 				}
 
-				size := uint16(b[s])
+				size := int(b[s])
 				s++
 
 				// Out of range?
-				if s+size+4 > total {
-					break loop
+				if s+size+2 > total {
+					return decodeError(ErrCorruptEntry, e.level.String(), s, s+size+2, total)
+				}
+
+				if strict && !utf8.Valid(b[s:s+size]) {
+					return decodeError(ErrInvalidUTF8, e.level.String(), s, 0, 0)
 				}
 
 				e.metricKeys[i] = toString(b[s:s+size], unsafe)
 				s += size
 
-				e.metricValues[i] = int32(binary.BigEndian.Uint32(b[s : s+4]))
-				s += 4
+				v := &e.metricValues[i]
+				v.Kind = MetricKind(b[s] >> 4)
+				v.Type = MetricType(b[s] & 0x0f)
+
+				if strict && (v.Kind > MetricTiming || v.Type > HistogramMetric) {
+					return decodeError(ErrCorruptEntry, e.level.String(), s, int(MetricTiming)<<4|int(HistogramMetric), int(b[s]))
+				}
+
+				size = int(b[s+1])
+				s += 2
+
+				// Out of range?
+				if s+size+1 > total {
+					return decodeError(ErrCorruptEntry, e.level.String(), s, s+size+1, total)
+				}
+
+				if strict && !utf8.Valid(b[s:s+size]) {
+					return decodeError(ErrInvalidUTF8, e.level.String(), s, 0, 0)
+				}
+
+				v.Unit = toString(b[s:s+size], unsafe)
+				s += size
+
+				if v.Type == HistogramMetric {
+					n := int(b[s])
+
+					// Out of range?
+					if n > MaxHistogramBuckets {
+						return decodeError(ErrCorruptEntry, e.level.String(), s, MaxHistogramBuckets, n)
+					}
+
+					s++
+
+					// Out of range?
+					if s+n*12 > total {
+						return decodeError(ErrCorruptEntry, e.level.String(), s, s+n*12, total)
+					}
+
+					start := len(e.histBounds)
+
+					for j := 0; j < n; j++ {
+						e.histBounds = append(e.histBounds, math.Float64frombits(binary.BigEndian.Uint64(b[s:])))
+						e.histCounts = append(e.histCounts, binary.BigEndian.Uint32(b[s+8:]))
+						s += 12
+					}
+
+					v.Histogram.Bounds = e.histBounds[start:len(e.histBounds):len(e.histBounds)]
+					v.Histogram.Counts = e.histCounts[start:len(e.histCounts):len(e.histCounts)]
+					v.Int = 0
+					v.Float = 0
+					continue
+				}
+
+				// Out of range?
+				if s+8 > total {
+					return decodeError(ErrCorruptEntry, e.level.String(), s, s+8, total)
+				}
+
+				v.Histogram = Histogram{}
+				bits := binary.BigEndian.Uint64(b[s:])
+				s += 8
+
+				if v.Type == FloatMetric {
+					v.Float = math.Float64frombits(bits)
+					v.Int = 0
+				} else {
+					v.Int = int64(bits)
+					v.Float = 0
+				}
 			}
 
 		// Meta count and length are dynamic and must not be out of range
 		case _7_Meta:
 			e.metaCount = b[s]
-			s++
 
 			// Out of range?
 			if e.metaCount > MaxMetaCount {
-				break loop
+				return decodeError(ErrCorruptEntry, e.level.String(), s, MaxMetaCount, int(e.metaCount))
 			}
 
+			s++
+
 			var i uint8
 			for i = 0; i < e.metaCount; i++ {
 
 				// Out of range?
 				if s >= total {
-					break loop
+					return decodeError(ErrCorruptEntry, e.level.String(), s, s+1, total)
 				}
 
-				size := uint16(b[s])
+				size := int(b[s])
 				s++
 
 				// Out of range?
-				if s+size+2 >= total {
-					break loop
+				if s+size+2 > total {
+					return decodeError(ErrCorruptEntry, e.level.String(), s, s+size+2, total)
+				}
+
+				if strict && !utf8.Valid(b[s:s+size]) {
+					return decodeError(ErrInvalidUTF8, e.level.String(), s, 0, 0)
 				}
 
 				e.metaKeys[i] = toString(b[s:s+size], unsafe)
 				s += size
 
-				size = binary.BigEndian.Uint16(b[s : s+2])
+				size = int(binary.BigEndian.Uint16(b[s : s+2]))
 				s += 2
 
 				// Out of range?
 				if s+size > total {
-					break loop
+					return decodeError(ErrCorruptEntry, e.level.String(), s, s+size, total)
+				}
+
+				if strict && !utf8.Valid(b[s:s+size]) {
+					return decodeError(ErrInvalidUTF8, e.level.String(), s, 0, 0)
 				}
 
 				e.metaValues[i] = toString(b[s:s+size], unsafe)
@@ -461,35 +764,63 @@ loop:
 
 		// Stack trace count and length are dynamic and must not be out of range
 		case _8_Stack_trace:
+			if legacy {
+				if s, err = e.decodeLegacyStackTrace(b, s, total, unsafe, strict); err != nil {
+					return
+				}
+
+				break
+			}
+
 			e.stackTraceCount = b[s]
-			s++
 
 			// Out of range?
 			if e.stackTraceCount > MaxStackTraceCount {
-				break loop
+				return decodeError(ErrCorruptEntry, e.level.String(), s, MaxStackTraceCount, int(e.stackTraceCount))
 			}
 
+			s++
+
 			var i uint8
 			for i = 0; i < e.stackTraceCount; i++ {
 
 				// Out of range?
 				if s >= total {
-					break loop
+					return decodeError(ErrCorruptEntry, e.level.String(), s, s+1, total)
 				}
 
-				size := uint16(b[s])
+				size := int(b[s])
 				s++
 
 				// Out of range?
-				if s+size+2 > total {
-					break loop
+				if s+size+1 > total {
+					return decodeError(ErrCorruptEntry, e.level.String(), s, s+size+1, total)
+				}
+
+				if strict && !utf8.Valid(b[s:s+size]) {
+					return decodeError(ErrInvalidUTF8, e.level.String(), s, 0, 0)
 				}
 
 				e.stackTracePaths[i] = toString(b[s:s+size], unsafe)
 				s += size
 
-				e.stackTraceLines[i] = binary.BigEndian.Uint16(b[s : s+2])
-				s += 2
+				size = int(b[s])
+				s++
+
+				// Out of range?
+				if s+size+4 > total {
+					return decodeError(ErrCorruptEntry, e.level.String(), s, s+size+4, total)
+				}
+
+				if strict && !utf8.Valid(b[s:s+size]) {
+					return decodeError(ErrInvalidUTF8, e.level.String(), s, 0, 0)
+				}
+
+				e.stackTraceFuncs[i] = toString(b[s:s+size], unsafe)
+				s += size
+
+				e.stackTraceLines[i] = binary.BigEndian.Uint32(b[s : s+4])
+				s += 4
 			}
 
 		// TTL is always 2 bytes and must not be out of range
@@ -497,7 +828,7 @@ loop:
 
 			// Out of range?
 			if s+2 > total {
-				break loop
+				return decodeError(ErrCorruptEntry, e.level.String(), s, s+2, total)
 			}
 
 			e.ttlEntry = binary.BigEndian.Uint16(b[s:])
@@ -505,45 +836,152 @@ loop:
 
 		// TTL is always 2 bytes and must not be out of range
 		case _10_TTL_Meta:
+
+			// Out of range?
+			if s+2 > total {
+				return decodeError(ErrCorruptEntry, e.level.String(), s, s+2, total)
+			}
+
 			e.ttlMeta = binary.BigEndian.Uint16(b[s:])
 			s += 2
+
+		// Timestamp is always 4 bytes and must not be out of range
+		case _11_Timestamp:
+
+			// Out of range?
+			if s+4 > total {
+				return decodeError(ErrCorruptEntry, e.level.String(), s, s+4, total)
+			}
+
+			e.nanos = binary.BigEndian.Uint32(b[s:])
+
+			if strict && e.nanos >= uint32(time.Second) {
+				return decodeError(ErrCorruptEntry, e.level.String(), s, int(time.Second)-1, int(e.nanos))
+			}
+
+			s += 4
+
+		// Correlation is always 37 bytes and must not be out of range
+		case _12_Correlation:
+
+			// Out of range?
+			if s+37 > total {
+				return decodeError(ErrCorruptEntry, e.level.String(), s, s+37, total)
+			}
+
+			s += copy(e.traceCtx.TraceId[:], b[s:])
+			s += copy(e.traceCtx.SpanId[:], b[s:])
+			e.traceCtx.Flags = b[s]
+			s++
+			s += copy(e.parentId[:], b[s:s+12])
+
+		// Truncation is always 2 bytes and must not be out of range
+		case _13_Truncation:
+
+			// Out of range?
+			if s+2 > total {
+				return decodeError(ErrCorruptEntry, e.level.String(), s, s+2, total)
+			}
+
+			e.truncated = Truncation(binary.BigEndian.Uint16(b[s:]))
+			s += 2
 		}
 
 		if s >= total {
-			break loop
+			break
 		}
 	}
 
 	if s != total {
-		return ErrCorruptEntry
+		return decodeError(ErrCorruptEntry, sectionSize, s, s, total)
 	}
 
 	return
 }
 
-func (e *Entry) addStackTrace(skip int) {
-	var trace [16]uintptr
-	n := runtime.Callers(skip, trace[:])
+// Records the stack trace, starting at the caller of the function calling this method. Any
+// further levels can be skipped, and the number of frames can be limited.
+func (e *Entry) addStackTrace(skip int, maxFrames int) {
+	// Stack traces are intentionally capped, so frames beyond the max aren't reported as dropped
+	var trace [MaxStackTraceCount]uintptr
+	maxFrames = min(maxFrames, MaxStackTraceCount)
+	n := runtime.Callers(skip+3, trace[:maxFrames])
 
 	if n == 0 {
 		return
 	}
 
+	trim := e.logger != nil && e.logger.pool.opt.TrimStackTrace
 	frames := runtime.CallersFrames(trace[:n])
-	e.stackTraceCount = uint8(n)
-	e.level = _8_Stack_trace
+	e.stackTraceCount = 0
+	e.level = max(e.level, _8_Stack_trace)
 
-	for i := 0; i < n; i++ {
-		frame, ok := frames.Next()
-		e.stackTracePaths[i] = frame.File
-		e.stackTraceLines[i] = uint16(frame.Line)
+	// Inlined calls might expand to more frames than program counters
+	for int(e.stackTraceCount) < maxFrames {
+		frame, more := frames.Next()
+		e.setStackFrame(e.stackTraceCount, frame.File, frame.Function, frame.Line, trim)
+		e.stackTraceCount++
 
-		if !ok {
+		if !more {
 			break
 		}
 	}
 }
 
+func (e *Entry) setStackFrame(i uint8, path, function string, line int, trim bool) {
+	if trim {
+		path, function = trimStackFrame(path, function)
+	}
+
+	e.stackTracePaths[i] = e.truncate(path, MaxStackTracePathSize, TruncatedStackTrace)
+	e.stackTraceFuncs[i] = e.truncate(function, MaxStackTraceFuncSize, TruncatedStackTrace)
+	e.stackTraceLines[i] = uint32(line)
+}
+
+// Verifies the Ed25519 signature of the entry by encoding it again. Returns `ErrMissingSignature`
+// if the entry isn't signed.
+func (e *Entry) Verify(pub ed25519.PublicKey) error {
+	var b [MaxEntrySize]byte
+	s := e.Encode(b[:])
+	return VerifySignature(b[:s], pub)
+}
+
+// Verifies the Ed25519 signature of an encoded entry, without decoding it. Returns
+// `ErrMissingSignature` if the entry isn't signed, and `ErrInvalidSignature` if the key isn't a
+// valid Ed25519 public key.
+func VerifySignature(b []byte, pub ed25519.PublicKey) error {
+	if len(b) < 19 {
+		return ErrTooShort
+	}
+
+	flags := b[18] &^ severityMask
+
+	if flags&flagSignature == 0 {
+		return ErrMissingSignature
+	}
+
+	end := len(b) - ed25519.SignatureSize
+
+	if flags&flagChecksum != 0 {
+		end -= 4
+	}
+
+	if end < 19 {
+		return ErrTooShort
+	}
+
+	// Verify panics on keys of the wrong size, e.g. a nil key
+	if len(pub) != ed25519.PublicKeySize {
+		return ErrInvalidSignature
+	}
+
+	if !ed25519.Verify(pub, b[:end], b[end:end+ed25519.SignatureSize]) {
+		return ErrInvalidSignature
+	}
+
+	return nil
+}
+
 func toString(b []byte, unsafe bool) string {
 	if unsafe {
 		return b2s(b)
@@ -566,36 +1004,90 @@ func (e *Entry) UnmarshalBinary(b []byte) error {
 
 // Sets the bucket ID of the entry. Chainable.
 func (e *Entry) Bucket(bucketId uint32) *Entry {
+	if e.noop {
+		return e
+	}
+
 	e.bucketId = bucketId
 	return e
 }
 
+// Attaches the identity of the process that emitted the entry. This is not encoded, as it's
+// sent once per connection rather than with every entry. Chainable.
+func (e *Entry) Resource(r *Resource) *Entry {
+	if e.noop {
+		return e
+	}
+
+	e.resource = r
+	return e
+}
+
+// Sets whether a CRC32C checksum should be appended when the entry is encoded, and
+// verified when decoded. Chainable.
+func (e *Entry) Checksum(enabled bool) *Entry {
+	if e.noop {
+		return e
+	}
+
+	if enabled {
+		e.flags |= flagChecksum
+		e.incLevel(_2_Severity)
+	} else {
+		e.flags &^= flagChecksum
+	}
+
+	return e
+}
+
 // Sets the ID of the entry. Chainable.
 func (e *Entry) Id(id xid.ID) *Entry {
+	if e.noop {
+		return e
+	}
+
 	e.id = id
 	return e
 }
 
-// Sets the timestamp of the entry by generating a new ID based on the timestamp. Chainable.
+// Sets the timestamp of the entry by generating a new ID based on the timestamp. Any
+// sub-second part of the timestamp is kept in nanosecond precision. Chainable.
 func (e *Entry) Time(t time.Time) *Entry {
+	if e.noop {
+		return e
+	}
+
 	e.id = xid.NewWithTime(t)
+	e.setNanos(uint32(t.Nanosecond()))
 	return e
 }
 
 // Sets the message of the entry. Chainable.
 func (e *Entry) Msg(msg string) *Entry {
-	e.message = msg
+	if e.noop {
+		return e
+	}
+
+	e.message = e.truncate(msg, MaxMessageSize, TruncatedMessage)
 	return e
 }
 
 // Sets the severity of the entry. Chainable.
 func (e *Entry) Sev(severity Severity) *Entry {
+	if e.noop {
+		return e
+	}
+
 	e.severity = severity
 	return e
 }
 
 // Sets the category ID of the entry. Chainable.
 func (e *Entry) Cat(categoryId uint8) *Entry {
+	if e.noop {
+		return e
+	}
+
 	e.incLevel(_4_CategoryId)
 	e.categoryId = categoryId
 	return e
@@ -603,18 +1095,23 @@ func (e *Entry) Cat(categoryId uint8) *Entry {
 
 // Appends tags to the entry. Stops if the entry's number of tags exceeds `MaxTagsCount`. Chainable.
 func (e *Entry) Tag(tags ...any) *Entry {
+	if e.noop {
+		return e
+	}
+
 	e.incLevel(_5_Tags)
 
 	for i := range tags {
-		if e.tagsCount >= MaxTagsCount {
-			break
-		}
-
 		if tags[i] == "" {
 			continue
 		}
 
-		e.tags[e.tagsCount] = truncate(stringify(tags[i]), MaxTagSize)
+		if e.tagsCount >= MaxTagsCount {
+			e.setTruncated(DroppedTags)
+			break
+		}
+
+		e.tags[e.tagsCount] = e.truncate(stringify(tags[i]), MaxTagSize, TruncatedTags)
 		e.tagsCount++
 	}
 
@@ -623,6 +1120,10 @@ func (e *Entry) Tag(tags ...any) *Entry {
 
 // Prepends tags to the entry and removes any tags that overflow `MaxTagsCount`. Chainable.
 func (e *Entry) PrependTag(tag ...any) *Entry {
+	if e.noop {
+		return e
+	}
+
 	e.incLevel(_5_Tags)
 
 	if e.tagsCount == 0 || len(tag) >= MaxTagsCount {
@@ -631,10 +1132,14 @@ func (e *Entry) PrependTag(tag ...any) *Entry {
 	}
 
 	if tag != nil {
+		if int(e.tagsCount)+len(tag) > MaxTagsCount {
+			e.setTruncated(DroppedTags)
+		}
+
 		copy(e.tags[len(tag):], e.tags[:e.tagsCount])
 
 		for i := range tag {
-			e.tags[i] = truncate(stringify(tag[i]), MaxTagSize)
+			e.tags[i] = e.truncate(stringify(tag[i]), MaxTagSize, TruncatedTags)
 
 			if e.tagsCount < MaxTagsCount {
 				e.tagsCount++
@@ -650,18 +1155,23 @@ func (e *Entry) MetaBlob(value any) *Entry {
 }
 
 func (e *Entry) Meta(key string, value any) *Entry {
+	if e.noop {
+		return e
+	}
+
 	e.incLevel(_7_Meta)
 
-	if e.metaCount >= MaxMetaCount {
+	if key == "" || value == "" {
 		return e
 	}
 
-	if key == "" || value == "" {
+	if e.metaCount >= MaxMetaCount {
+		e.setTruncated(DroppedMeta)
 		return e
 	}
 
-	e.metaKeys[e.metaCount] = truncate(key, MaxMetaKeySize)
-	e.metaValues[e.metaCount] = truncate(stringify(value), MaxMetaValueSize)
+	e.metaKeys[e.metaCount] = e.truncate(key, MaxMetaKeySize, TruncatedMeta)
+	e.metaValues[e.metaCount] = e.truncate(stringify(value), MaxMetaValueSize, TruncatedMeta)
 	e.metaCount++
 
 	return e
@@ -670,6 +1180,10 @@ func (e *Entry) Meta(key string, value any) *Entry {
 // Pass eighter a `map[string]any` or `map[string]string`, and all key-value pairs
 // will be added as meta. Chainable.
 func (e *Entry) MetaFromMap(m any) *Entry {
+	if e.noop {
+		return e
+	}
+
 	switch m := m.(type) {
 	case map[string]any:
 		for k, v := range m {
@@ -685,18 +1199,57 @@ func (e *Entry) MetaFromMap(m any) *Entry {
 	return e
 }
 
+// Adds a 32-bit integer gauge to the entry. Chainable.
 func (e *Entry) Metric(key string, value int32) *Entry {
-	e.incLevel(_6_Metric)
+	return e.AddMetric(key, MetricValue{Int: int64(value)})
+}
 
-	if e.metricCount >= MaxMetricCount {
+// Adds a 64-bit integer gauge to the entry, with an optional unit. Chainable.
+func (e *Entry) MetricInt(key string, value int64, unit ...string) *Entry {
+	return e.AddMetric(key, MetricValue{Int: value, Unit: metricUnit(unit)})
+}
+
+// Adds a float gauge to the entry, with an optional unit. Chainable.
+func (e *Entry) MetricFloat(key string, value float64, unit ...string) *Entry {
+	return e.AddMetric(key, MetricValue{Float: value, Type: FloatMetric, Unit: metricUnit(unit)})
+}
+
+// Adds a counter to the entry, with an optional unit. Chainable.
+func (e *Entry) Counter(key string, value int64, unit ...string) *Entry {
+	return e.AddMetric(key, MetricValue{Int: value, Kind: MetricCounter, Unit: metricUnit(unit)})
+}
+
+// Adds a duration to the entry, stored as fractional milliseconds. Chainable.
+func (e *Entry) Timing(key string, d time.Duration) *Entry {
+	return e.AddMetric(key, metricTiming(d))
+}
+
+// Adds a pre-aggregated histogram gauge to the entry, with an optional unit. Buckets beyond
+// `MaxHistogramBuckets` are dropped. Use `AddMetric` for histograms of another kind, e.g. of
+// latencies. Chainable.
+func (e *Entry) Histogram(key string, h Histogram, unit ...string) *Entry {
+	return e.AddMetric(key, MetricValue{Histogram: h, Type: HistogramMetric, Unit: metricUnit(unit)})
+}
+
+// Adds a metric of any kind and type to the entry. Chainable.
+func (e *Entry) AddMetric(key string, value MetricValue) *Entry {
+	if e.noop {
 		return e
 	}
 
+	e.incLevel(_6_Metric)
+
 	if key == "" {
 		return e
 	}
 
-	e.metricKeys[e.metricCount] = truncate(key, MaxMetaKeySize)
+	if e.metricCount >= MaxMetricCount {
+		e.setTruncated(DroppedMetrics)
+		return e
+	}
+
+	value.Unit = e.truncate(value.Unit, MaxMetricUnitSize, TruncatedMetrics)
+	e.metricKeys[e.metricCount] = e.truncate(key, MaxMetaKeySize, TruncatedMetrics)
 	e.metricValues[e.metricCount] = value
 	e.metricCount++
 
@@ -706,55 +1259,115 @@ func (e *Entry) Metric(key string, value int32) *Entry {
 // Sets the stack trace to the current line of code. This operation is expensive compared
 // to any other method. You can optionally skip levels. Chainable.
 func (e *Entry) Trace(skipLevels ...int) *Entry {
+	if e.noop {
+		return e
+	}
+
 	e.incLevel(_8_Stack_trace)
 
 	if skipLevels != nil {
-		e.addStackTrace(1 + skipLevels[0])
+		e.addStackTrace(skipLevels[0], MaxStackTraceCount)
 	} else {
-		e.addStackTrace(1)
+		e.addStackTrace(0, MaxStackTraceCount)
 	}
 
 	return e
 }
 
 // Appens to the stack trace manually - this should most likely not be used unless you want to
-// load an entry from an external source, e.g. database. Chainable.
-func (e *Entry) ManualTrace(path string, line uint16) *Entry {
+// load an entry from an external source, e.g. database. Optionally pass the function name. Chainable.
+func (e *Entry) ManualTrace(path string, line uint32, function ...string) *Entry {
+	if e.noop {
+		return e
+	}
+
 	e.incLevel(_8_Stack_trace)
 
-	if e.stackTraceCount < MaxStackTraceCount {
-		e.stackTracePaths[e.stackTraceCount] = path
-		e.stackTraceLines[e.stackTraceCount] = line
-		e.stackTraceCount++
+	if e.stackTraceCount >= MaxStackTraceCount {
+		e.setTruncated(DroppedStackTrace)
+		return e
+	}
+
+	e.stackTracePaths[e.stackTraceCount] = e.truncate(path, MaxStackTracePathSize, TruncatedStackTrace)
+	e.stackTraceFuncs[e.stackTraceCount] = ""
+	e.stackTraceLines[e.stackTraceCount] = line
+
+	if function != nil {
+		e.stackTraceFuncs[e.stackTraceCount] = e.truncate(function[0], MaxStackTraceFuncSize, TruncatedStackTrace)
 	}
 
+	e.stackTraceCount++
+
+	return e
+}
+
+// Sets the W3C trace context of the entry, for correlating it with distributed traces. Chainable.
+func (e *Entry) TraceContext(tc TraceContext) *Entry {
+	if e.noop {
+		return e
+	}
+
+	e.incLevel(_12_Correlation)
+	e.traceCtx = tc
+	return e
+}
+
+// Sets the ID of a parent entry, e.g. the entry that caused this one. Chainable.
+func (e *Entry) Parent(id xid.ID) *Entry {
+	if e.noop {
+		return e
+	}
+
+	e.incLevel(_12_Correlation)
+	e.parentId = id
 	return e
 }
 
 func (e *Entry) TTL(days uint16) *Entry {
+	if e.noop {
+		return e
+	}
+
 	e.incLevel(_9_TTL_Entry)
 	e.ttlEntry = days
 	return e
 }
 
 func (e *Entry) MetaTTL(days uint16) *Entry {
+	if e.noop {
+		return e
+	}
+
 	e.incLevel(_10_TTL_Meta)
 	e.ttlMeta = days
 	return e
 }
 
-// Sends the entry to the log and returns its unique ID. Optionally adjust the category ID.
+// Sends the entry to the log and returns its unique ID. Optionally adjust the category ID. A nil
+// ID is returned for entries that aren't sent: filtered entries, duplicates collapsed by a
+// deduplicator, and entries refused once the client has been closed.
 func (e *Entry) Send(cat ...uint8) (id xid.ID) {
+	if e.noop || e.logger != nil && e.logger.pool.closed.Load() {
+		return
+	}
+
 	id = e.id
 
 	if cat != nil {
 		e.Cat(cat[0])
 	}
 
+	if e.cause != nil {
+		e.addCause()
+	}
+
 	// Any tags, meta and metrics are appended from the logger in ths stage
 	if e.logger != nil {
+		e.setTruncated(e.logger.truncated)
+
 		for i := range e.logger.tags {
 			if e.tagsCount >= MaxTagsCount {
+				e.setTruncated(DroppedTags)
 				break
 			}
 
@@ -764,6 +1377,7 @@ func (e *Entry) Send(cat ...uint8) (id xid.ID) {
 
 		for i := range e.logger.metaKeys {
 			if e.metaCount >= MaxMetaCount {
+				e.setTruncated(DroppedMeta)
 				break
 			}
 
@@ -774,6 +1388,7 @@ func (e *Entry) Send(cat ...uint8) (id xid.ID) {
 
 		for i := range e.logger.metricKeys {
 			if e.metricCount >= MaxMetricCount {
+				e.setTruncated(DroppedMetrics)
 				break
 			}
 
@@ -782,12 +1397,57 @@ func (e *Entry) Send(cat ...uint8) (id xid.ID) {
 			e.metricCount++
 		}
 
-		e.logger.pool.client.ProcessEntry(context.Background(), e)
+		// Level rules can only match the final category of the entry once it's sent
+		if !e.logger.admitsEntry(e) {
+			return nilId
+		}
+
+		if e.logger.dedup != nil && !e.logger.dedup.add(e) {
+			return nilId
+		}
+
+		e.logger.pool.client.ProcessEntry(e.logger.context(), e)
 	}
 
 	return
 }
 
+// Sends the entry, waits for the client to flush and close (at most `PoolOptions.FlushTimeout`),
+// and exits the process with `PoolOptions.ExitFunc` - or `DefaultExitFunc` if the entry doesn't
+// belong to a pool. Optionally adjust the category ID.
+func (e *Entry) Fatal(cat ...uint8) {
+	e.Send(cat...)
+
+	if e.logger == nil {
+		DefaultExitFunc(1)
+		return
+	}
+
+	pool := e.logger.pool
+	ctx, cancel := context.WithTimeout(context.Background(), pool.opt.FlushTimeout)
+	defer cancel()
+	pool.Flush(ctx)
+	pool.CloseClient(ctx)
+	pool.opt.ExitFunc(1)
+}
+
+// Sends the entry, waits for the client to flush (at most `PoolOptions.FlushTimeout`), and
+// panics with the entry. Optionally adjust the category ID. Filtered entries aren't kept, so
+// they panic with `ErrFiltered` instead.
+func (e *Entry) Panic(cat ...uint8) {
+	e.Send(cat...)
+
+	if e.logger != nil {
+		e.logger.pool.flush()
+	}
+
+	if e.noop {
+		panic(ErrFiltered)
+	}
+
+	panic(e)
+}
+
 // Returns a readable interface of the entry.
 func (e *Entry) Read() entryReader {
 	return entryReader{e}
@@ -795,11 +1455,31 @@ func (e *Entry) Read() entryReader {
 
 // Releases the entry back to the pool. Any usage of the entry afterwards might panic.
 func (e *Entry) Drop() {
-	if e.logger != nil {
+	if e.logger != nil && !e.noop {
 		e.logger.pool.ReleaseEntry(e)
 	}
 }
 
+// Copies the entry, so that the copy can be kept after the entry has been released. The copy
+// belongs to the pool's logger, as the entry's logger might be released too.
+func (e *Entry) copyFrom(src *Entry) {
+	*e = *src
+	e.histBounds = nil
+	e.histCounts = nil
+
+	if src.logger != nil {
+		e.logger = src.logger.pool.logger
+	}
+}
+
+func (e *Entry) setNanos(nanos uint32) {
+	e.nanos = nanos
+
+	if nanos != 0 {
+		e.incLevel(_11_Timestamp)
+	}
+}
+
 func (e *Entry) incLevel(lvl level) {
 	e.level = max(e.level, lvl)
 }
@@ -0,0 +1,140 @@
+package logger
+
+import (
+	"encoding/binary"
+
+	"github.com/rs/xid"
+)
+
+/*
+	Attachment chunk
+		2 bytes (uint16) size annotation
+		4 bytes (uint32) bucket ID
+		12 bytes XID of the entry the attachment belongs to
+		1 byte flags (0x20)
+		1 byte (uint8) key length (X)
+		X bytes string key
+		4 bytes (uint32) total size of the value
+		4 bytes (uint32) offset of the chunk in the value
+		Remaining bytes: chunk of the value
+
+	Attachments are too large to fit in an entry, and are instead split into chunks that are
+	sent before the entry itself. The receiver reassembles the chunks and attaches them to the
+	entry with the same ID.
+*/
+
+const (
+	MaxAttachmentCount       = 4
+	DefaultMaxAttachmentSize = 1 << 20
+	attachmentHeaderSize     = 2 + 4 + 12 + 1 + 1 + 4 + 4
+)
+
+// A chunk of an attachment, as decoded from a frame.
+type AttachmentChunk struct {
+	Key      string
+	Data     []byte
+	Id       xid.ID
+	BucketId uint32
+	Total    uint32
+	Offset   uint32
+}
+
+// Returns whether an encoded frame is an attachment chunk rather than an entry.
+func IsAttachmentChunk(b []byte) bool {
+	return len(b) > 18 && b[18]&flagAttachment != 0
+}
+
+// Decodes an attachment chunk. The key and data will reference b directly.
+func (c *AttachmentChunk) Decode(b []byte) (err error) {
+	if len(b) < attachmentHeaderSize {
+		return ErrTooShort
+	}
+
+	if int(binary.BigEndian.Uint16(b)) != len(b) || b[18]&flagAttachment == 0 {
+		return ErrCorruptEntry
+	}
+
+	c.BucketId = binary.BigEndian.Uint32(b[2:])
+
+	if c.Id, err = xid.FromBytes(b[6:18]); err != nil {
+		return
+	}
+
+	s := 19
+	size := int(b[s])
+	s++
+
+	// Out of range?
+	if s+size+8 > len(b) {
+		return ErrCorruptEntry
+	}
+
+	c.Key = b2s(b[s : s+size])
+	s += size
+	c.Total = binary.BigEndian.Uint32(b[s:])
+	c.Offset = binary.BigEndian.Uint32(b[s+4:])
+	s += 8
+	c.Data = b[s:]
+
+	// Out of range?
+	if uint64(c.Offset)+uint64(len(c.Data)) > uint64(c.Total) {
+		return ErrCorruptEntry
+	}
+
+	return
+}
+
+// Encodes a chunk of the attachment with index i, starting at offset, into b. If b isn't large
+// enough for at least the header we will panic. Returns number of bytes written, and the offset
+// of the next chunk - which equals the size of the value when the last chunk is written.
+func (e *Entry) EncodeAttachment(b []byte, i int, offset int) (s int, next int) {
+	key := e.attachKeys[i]
+	value := e.attachValues[i]
+
+	s += 2
+	binary.BigEndian.PutUint32(b[s:], e.bucketId)
+	s += 4
+	s += copy(b[s:], e.id[:])
+	b[s] = flagAttachment
+	s++
+	b[s] = uint8(len(key))
+	s++
+	s += copy(b[s:], key)
+	binary.BigEndian.PutUint32(b[s:], uint32(len(value)))
+	binary.BigEndian.PutUint32(b[s+4:], uint32(offset))
+	s += 8
+	s += copy(b[s:min(len(b), MaxEntrySize)], value[offset:])
+	binary.BigEndian.PutUint16(b, uint16(s))
+
+	return s, offset + s - (attachmentHeaderSize + len(key))
+}
+
+// Attaches a value that is too large to be stored as meta, e.g. a request body or a goroutine
+// dump. It's split into chunks that are sent separately before the entry. Values of entries
+// created from a logger are truncated to `PoolOptions.MaxAttachmentSize`. Chainable.
+func (e *Entry) Attach(key string, value any) *Entry {
+	if e.noop {
+		return e
+	}
+
+	if key == "" || value == "" {
+		return e
+	}
+
+	if e.attachCount >= MaxAttachmentCount {
+		e.setTruncated(DroppedAttachments)
+		return e
+	}
+
+	str := stringify(value)
+
+	if e.logger != nil {
+		str = e.truncate(str, e.logger.pool.opt.MaxAttachmentSize, TruncatedAttachments)
+	}
+
+	e.attachKeys[e.attachCount] = e.truncate(key, MaxMetaKeySize, TruncatedAttachments)
+	e.attachValues[e.attachCount] = str
+	e.attachCount++
+
+	return e
+}
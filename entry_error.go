@@ -0,0 +1,112 @@
+package logger
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// Max number of causes recorded from an error chain
+const MaxErrorCauses = 8
+
+// Fills the entry from an error: the message and tags are parsed from the error string, and
+// every cause in the chain (including branches of multi-errors) is recorded as meta with its
+// message and Go type. Any errors in the chain implementing `ErrorDecorator` decorate the
+// entry, with outer errors applied last.
+func (e *Entry) captureError(err error) *Entry {
+	if e.noop {
+		return e
+	}
+
+	var chain [MaxErrorCauses + 1]error
+
+	parseErrorString(e, err.Error())
+
+	if e = e.sample(); e.noop {
+		return e
+	}
+
+	chain[0] = err
+	n := appendCauses(chain[:], 1, err)
+
+	e.Meta("error.type", fmt.Sprintf("%T", err))
+	e.causeMeta(chain[1:n])
+
+	for i := n - 1; i >= 0; i-- {
+		if d, ok := chain[i].(ErrorDecorator); ok {
+			d.DecorateEntry(e)
+		}
+	}
+
+	return e
+}
+
+// Wraps an error as the cause of the entry, which is returned by `Unwrap` so that `errors.Is`
+// and `errors.As` work through the entry. The cause and its chain is recorded as meta when the
+// entry is sent. Chainable.
+func (e *Entry) Wrap(err error) *Entry {
+	if e.noop {
+		return e
+	}
+
+	e.cause = err
+	return e
+}
+
+// Returns the cause of the entry, if any.
+func (e Entry) Unwrap() error {
+	return e.cause
+}
+
+// Records the cause of the entry and its chain as meta.
+func (e *Entry) addCause() {
+	var chain [MaxErrorCauses]error
+
+	chain[0] = e.cause
+	n := appendCauses(chain[:], 1, e.cause)
+	e.causeMeta(chain[:n])
+}
+
+// Records each error in a chain of causes as meta, with its message and Go type.
+func (e *Entry) causeMeta(chain []error) {
+	for i, err := range chain {
+		key := "cause." + strconv.Itoa(i+1)
+		e.Meta(key, err.Error())
+		e.Meta(key+".type", fmt.Sprintf("%T", err))
+	}
+}
+
+// Appends the causes of an error depth-first to the chain, until it's full. Returns the new
+// length of the chain.
+func appendCauses(chain []error, n int, err error) int {
+	switch err := err.(type) {
+	case interface{ Unwrap() error }:
+		if cause := err.Unwrap(); cause != nil && n < len(chain) {
+			chain[n] = cause
+			n = appendCauses(chain, n+1, cause)
+		}
+
+	case interface{ Unwrap() []error }:
+		for _, cause := range err.Unwrap() {
+			if cause == nil || n >= len(chain) {
+				continue
+			}
+
+			chain[n] = cause
+			n = appendCauses(chain, n+1, cause)
+		}
+	}
+
+	return n
+}
+
+// Consults the logger's sampler on the entry's message, e.g. once it has been parsed from an
+// error. Returns a no-op entry if the entry was suppressed, in which case it's released.
+func (e *Entry) sample() *Entry {
+	if e.logger.sample(e.severity, e.message) {
+		return e
+	}
+
+	pool := e.logger.pool
+	e.Drop()
+	return pool.noop
+}
@@ -0,0 +1,53 @@
+package logger
+
+import (
+	"fmt"
+	"hash/fnv"
+)
+
+// Size of the fingerprint trailer
+const fingerprintSize = 8
+
+// Returns a stable fingerprint of the entry, for grouping entries of the same kind. It's a 64-bit
+// FNV-1a hash of the message template (not the tags interpolated into it), the category ID and
+// the top stack frame's path and function (not its line, which changes with unrelated edits).
+// Decoded entries return the transmitted fingerprint, if any (see `IncludeFingerprint`).
+func (e *Entry) Fingerprint() uint64 {
+	if e.fingerprint != 0 {
+		return e.fingerprint
+	}
+
+	h := fnv.New64a()
+	h.Write(s2b(e.message))
+	h.Write([]byte{0, e.categoryId})
+
+	if e.stackTraceCount > 0 {
+		h.Write(s2b(e.stackTracePaths[0]))
+		h.Write([]byte{0})
+		h.Write(s2b(e.stackTraceFuncs[0]))
+	}
+
+	return h.Sum64()
+}
+
+// Sets whether the fingerprint should be appended when the entry is encoded, so that servers
+// can group entries without recomputing it. Chainable.
+func (e *Entry) IncludeFingerprint(enabled bool) *Entry {
+	if e.noop {
+		return e
+	}
+
+	if enabled {
+		e.flags |= flagFingerprint
+		e.incLevel(_2_Severity)
+	} else {
+		e.flags &^= flagFingerprint
+	}
+
+	return e
+}
+
+// Formats a fingerprint as 16 hexadecimal digits.
+func FormatFingerprint(fingerprint uint64) string {
+	return fmt.Sprintf("%016x", fingerprint)
+}
@@ -0,0 +1,193 @@
+package logger
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+var messageEscaper = strings.NewReplacer("%", "%%", "{", "{{", "}", "}}")
+
+// Escapes a string so that it's rendered as is when used as a message, e.g. for messages that
+// aren't templates.
+func EscapeMessage(str string) string {
+	if strings.IndexAny(str, "%{}") < 0 {
+		return str
+	}
+
+	return messageEscaper.Replace(str)
+}
+
+// Renders the message template, where placeholders are replaced with values:
+//
+//	%s, %d, %.2f, %q, ...  The next tag, formatted with the verb
+//	{key}                  The meta value with the key
+//	%%, {{, }}             A literal %, { or }
+//
+// Placeholders without a value are kept as they are. As the values are kept apart from the
+// template until rendered, the template can be used for grouping.
+func formatMessage(e *Entry) string {
+	msg := e.message
+
+	if strings.IndexAny(msg, "%{}") < 0 {
+		return msg
+	}
+
+	var (
+		b      strings.Builder
+		tagIdx uint8
+	)
+
+	b.Grow(len(msg))
+
+	for i := 0; i < len(msg); i++ {
+		c := msg[i]
+
+		switch c {
+		case '%':
+			if i+1 >= len(msg) {
+				b.WriteByte(c)
+				continue
+			}
+
+			if msg[i+1] == '%' {
+				b.WriteByte('%')
+				i++
+				continue
+			}
+
+			spec, verb := parseVerb(msg[i:])
+
+			if verb != 0 && tagIdx < e.tagsCount {
+				b.WriteString(formatTag(spec, verb, e.tags[tagIdx]))
+				tagIdx++
+			} else {
+				b.WriteString(spec)
+			}
+
+			i += len(spec) - 1
+
+		case '{', '}':
+			if i+1 < len(msg) && msg[i+1] == c {
+				b.WriteByte(c)
+				i++
+				continue
+			}
+
+			if c == '{' {
+				if key, ok := parsePlaceholder(msg[i+1:]); ok {
+					if value, ok := e.metaValue(key); ok {
+						b.WriteString(value)
+						i += len(key) + 1
+						continue
+					}
+				}
+			}
+
+			b.WriteByte(c)
+
+		default:
+			b.WriteByte(c)
+		}
+	}
+
+	return b.String()
+}
+
+// Parses a printf verb with any flags, width and precision, e.g. "%-8.2f".
+func parseVerb(str string) (spec string, verb rune) {
+	i := 1
+
+	for i < len(str) && strings.IndexByte("+-# 0", str[i]) >= 0 {
+		i++
+	}
+
+	for i < len(str) && (isDigit(str[i]) || str[i] == '.') {
+		i++
+	}
+
+	if i >= len(str) {
+		return str, 0
+	}
+
+	verb, size := utf8.DecodeRuneInString(str[i:])
+	return str[:i+size], verb
+}
+
+// Formats a tag with a printf verb. Tags are strings, so they are parsed as the type that the
+// verb expects. Tags that can't be parsed, and unknown verbs, are formatted as strings.
+func formatTag(spec string, verb rune, tag string) string {
+	switch verb {
+	case 'd', 'b', 'o', 'x', 'X', 'c', 'U':
+		if v, err := strconv.ParseInt(tag, 10, 64); err == nil {
+			return fmt.Sprintf(spec, v)
+		}
+
+		if v, err := strconv.ParseUint(tag, 10, 64); err == nil {
+			return fmt.Sprintf(spec, v)
+		}
+
+		if verb == 'x' || verb == 'X' {
+			return fmt.Sprintf(spec, tag)
+		}
+
+	case 'e', 'E', 'f', 'F', 'g', 'G':
+		if v, err := strconv.ParseFloat(tag, 64); err == nil {
+			return fmt.Sprintf(spec, v)
+		}
+
+	case 't':
+		if v, err := strconv.ParseBool(tag); err == nil {
+			return fmt.Sprintf(spec, v)
+		}
+
+	case 'q':
+		return fmt.Sprintf(spec, tag)
+	}
+
+	if len(spec) == 2 {
+		return tag
+	}
+
+	// Keep any flags, width and precision
+	i := len(spec) - 1
+
+	for !utf8.RuneStart(spec[i]) {
+		i--
+	}
+
+	return fmt.Sprintf(spec[:i]+"s", tag)
+}
+
+// Parses the key of a named placeholder, e.g. "user" of "{user}". Keys may contain letters,
+// digits, '.', '_' and '-'.
+func parsePlaceholder(str string) (key string, ok bool) {
+	for i := 0; i < len(str); i++ {
+		c := str[i]
+
+		if c == '}' {
+			return str[:i], i > 0
+		}
+
+		if !isLetter(c) && !isDigit(c) && c != '.' && c != '_' && c != '-' {
+			return
+		}
+	}
+
+	return
+}
+
+func (e *Entry) metaValue(key string) (string, bool) {
+	for i := uint8(0); i < e.metaCount; i++ {
+		if e.metaKeys[i] == key {
+			return e.metaValues[i], true
+		}
+	}
+
+	return "", false
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
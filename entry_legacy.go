@@ -0,0 +1,237 @@
+package logger
+
+import (
+	"encoding/binary"
+	"math"
+	"unicode/utf8"
+)
+
+// Encodes the entry like `Encode`, but in the layout of peers before protocol v1.2-ack. Metric
+// values are rounded and clamped to 32-bit integers and histograms are left out, stack traces
+// are left without function names, and flags, trailers, timestamps, correlation and truncation
+// are left out.
+func (e *Entry) EncodeLegacy(b []byte) (s int) {
+	var i uint8
+	var l level
+
+	// Reserve space for the TTLs after any dropped fields
+	limit := MaxEntrySize - 4
+
+	// Reserve two bytes for the size annotation
+	s += 2
+
+	for l = 0; l <= min(e.level, _10_TTL_Meta); l++ {
+		switch l {
+
+		case _0_BucketId:
+			binary.BigEndian.PutUint32(b[s:], e.bucketId)
+			s += 4
+
+		case _1_EntryId:
+			s += copy(b[s:], e.id[:])
+
+		case _2_Severity:
+			b[s] = uint8(e.severity) & severityMask
+			s++
+
+		case _3_Message:
+			b[s] = uint8(len(e.message))
+			s++
+			s += copy(b[s:], e.message)
+
+		case _4_CategoryId:
+			b[s] = e.categoryId
+			s++
+
+		case _5_Tags:
+			b[s] = e.tagsCount
+			s++
+			for i = 0; i < e.tagsCount; i++ {
+				b[s] = uint8(len(e.tags[i]))
+				s++
+				s += copy(b[s:], e.tags[i])
+			}
+
+		case _6_Metric:
+			pos := s
+			b[pos] = 0
+			s++
+			for i = 0; i < e.metricCount; i++ {
+				keyLen := len(e.metricKeys[i])
+				v := &e.metricValues[i]
+
+				if v.Type == HistogramMetric {
+					continue
+				}
+
+				if s+keyLen+5 > limit {
+					break
+				}
+
+				b[s] = uint8(keyLen)
+				s++
+				s += copy(b[s:], e.metricKeys[i])
+				binary.BigEndian.PutUint32(b[s:], uint32(legacyMetricValue(v)))
+				s += 4
+				b[pos]++
+			}
+
+		case _7_Meta:
+			pos := s
+			b[s] = e.metaCount
+			s++
+			for i = 0; i < e.metaCount; i++ {
+				keyLen := len(e.metaKeys[i])
+				valLen := len(e.metaValues[i])
+
+				if s+keyLen+valLen+3 > limit {
+					b[pos] = i
+					break
+				}
+
+				b[s] = uint8(keyLen)
+				s++
+				s += copy(b[s:], e.metaKeys[i])
+				binary.BigEndian.PutUint16(b[s:], uint16(valLen))
+				s += 2
+				s += copy(b[s:], e.metaValues[i])
+			}
+
+		case _8_Stack_trace:
+			pos := s
+			b[s] = e.stackTraceCount
+			s++
+			for i = 0; i < e.stackTraceCount; i++ {
+				pathLen := len(e.stackTracePaths[i])
+
+				if s+pathLen+3 > limit {
+					b[pos] = i
+					break
+				}
+
+				b[s] = uint8(pathLen)
+				s++
+				s += copy(b[s:], e.stackTracePaths[i])
+				binary.BigEndian.PutUint16(b[s:], uint16(min(e.stackTraceLines[i], math.MaxUint16)))
+				s += 2
+			}
+
+		case _9_TTL_Entry:
+			binary.BigEndian.PutUint16(b[s:], e.ttlEntry)
+			s += 2
+
+		case _10_TTL_Meta:
+			binary.BigEndian.PutUint16(b[s:], e.ttlMeta)
+			s += 2
+		}
+	}
+
+	binary.BigEndian.PutUint16(b, uint16(s))
+	return
+}
+
+// Decodes like `Decode`, but from the layout of peers before protocol v1.2-ack.
+func (e *Entry) DecodeLegacy(b []byte, noCopy ...bool) (err error) {
+	return e.decode(b, noCopy != nil && noCopy[0], false, true)
+}
+
+// Decodes like `DecodeStrict`, but from the layout of peers before protocol v1.2-ack.
+func (e *Entry) DecodeLegacyStrict(b []byte, noCopy ...bool) (err error) {
+	return e.decode(b, noCopy != nil && noCopy[0], true, true)
+}
+
+// Decodes metrics of 32-bit integers, starting at the metric count in b[s].
+func (e *Entry) decodeLegacyMetrics(b []byte, s int, total int, unsafe bool, strict bool) (int, error) {
+	e.metricCount = b[s]
+
+	// Out of range?
+	if e.metricCount > MaxMetricCount {
+		return s, decodeError(ErrCorruptEntry, e.level.String(), s, MaxMetricCount, int(e.metricCount))
+	}
+
+	s++
+
+	var i uint8
+	for i = 0; i < e.metricCount; i++ {
+
+		// Out of range?
+		if s >= total {
+			return s, decodeError(ErrCorruptEntry, e.level.String(), s, s+1, total)
+		}
+
+		size := int(b[s])
+		s++
+
+		// Out of range?
+		if s+size+4 > total {
+			return s, decodeError(ErrCorruptEntry, e.level.String(), s, s+size+4, total)
+		}
+
+		if strict && !utf8.Valid(b[s:s+size]) {
+			return s, decodeError(ErrInvalidUTF8, e.level.String(), s, 0, 0)
+		}
+
+		e.metricKeys[i] = toString(b[s:s+size], unsafe)
+		s += size
+
+		e.metricValues[i] = MetricValue{Int: int64(int32(binary.BigEndian.Uint32(b[s:])))}
+		s += 4
+	}
+
+	return s, nil
+}
+
+// Decodes stack traces of paths with 16-bit line numbers, starting at the frame count in b[s].
+func (e *Entry) decodeLegacyStackTrace(b []byte, s int, total int, unsafe bool, strict bool) (int, error) {
+	e.stackTraceCount = b[s]
+
+	// Out of range?
+	if e.stackTraceCount > MaxStackTraceCount {
+		return s, decodeError(ErrCorruptEntry, e.level.String(), s, MaxStackTraceCount, int(e.stackTraceCount))
+	}
+
+	s++
+
+	var i uint8
+	for i = 0; i < e.stackTraceCount; i++ {
+
+		// Out of range?
+		if s >= total {
+			return s, decodeError(ErrCorruptEntry, e.level.String(), s, s+1, total)
+		}
+
+		size := int(b[s])
+		s++
+
+		// Out of range?
+		if s+size+2 > total {
+			return s, decodeError(ErrCorruptEntry, e.level.String(), s, s+size+2, total)
+		}
+
+		if strict && !utf8.Valid(b[s:s+size]) {
+			return s, decodeError(ErrInvalidUTF8, e.level.String(), s, 0, 0)
+		}
+
+		e.stackTracePaths[i] = toString(b[s:s+size], unsafe)
+		e.stackTraceFuncs[i] = ""
+		s += size
+
+		e.stackTraceLines[i] = uint32(binary.BigEndian.Uint16(b[s:]))
+		s += 2
+	}
+
+	return s, nil
+}
+
+// Rounds and clamps a metric value to a 32-bit integer.
+func legacyMetricValue(v *MetricValue) int32 {
+	if v.Type == FloatMetric {
+		if math.IsNaN(v.Float) {
+			return 0
+		}
+
+		return int32(max(math.MinInt32, min(math.Round(v.Float), math.MaxInt32)))
+	}
+
+	return int32(max(math.MinInt32, min(v.Int, math.MaxInt32)))
+}
@@ -0,0 +1,135 @@
+package logger
+
+import (
+	"math"
+	"strconv"
+	"time"
+)
+
+// What a metric measures, which decides how it can be aggregated.
+type MetricKind uint8
+
+const (
+	MetricGauge   MetricKind = iota // A value at a point in time, e.g. memory usage
+	MetricCounter                   // A number of occurrences that can be summed, e.g. bytes sent
+	MetricTiming                    // A duration, e.g. latency
+)
+
+// How a metric value is stored.
+type MetricType uint8
+
+const (
+	IntMetric       MetricType = iota // 64-bit signed integer
+	FloatMetric                       // 64-bit float
+	HistogramMetric                   // Pre-aggregated buckets
+)
+
+// A metric value of any type, with an optional unit (e.g. "ms" or "bytes").
+type MetricValue struct {
+	Unit      string
+	Histogram Histogram
+	Int       int64
+	Float     float64
+	Kind      MetricKind
+	Type      MetricType
+}
+
+// Implements stringer interface
+func (v MetricValue) String() string {
+	var s string
+
+	switch v.Type {
+	case IntMetric:
+		s = strconv.FormatInt(v.Int, 10)
+	case FloatMetric:
+		s = strconv.FormatFloat(v.Float, 'f', -1, 64)
+	case HistogramMetric:
+		s = v.Histogram.String()
+	}
+
+	if v.Unit != "" {
+		s += " " + v.Unit
+	}
+
+	return s
+}
+
+// Pre-aggregated histogram, e.g. of latencies. Each bucket counts the values less than or
+// equal to its upper bound, but greater than the bound of the previous bucket. The bounds
+// must be ascending, and the last bound may be `math.Inf(1)`.
+type Histogram struct {
+	Bounds []float64
+	Counts []uint32
+}
+
+// Number of buckets in the histogram.
+func (h Histogram) Len() int {
+	return min(min(len(h.Bounds), len(h.Counts)), MaxHistogramBuckets)
+}
+
+// Total number of values in the histogram.
+func (h Histogram) Total() (total uint64) {
+	for i := 0; i < h.Len(); i++ {
+		total += uint64(h.Counts[i])
+	}
+
+	return
+}
+
+// Implements stringer interface
+func (h Histogram) String() string {
+	b := make([]byte, 0, 16*h.Len())
+	b = append(b, '[')
+
+	for i := 0; i < h.Len(); i++ {
+		if i != 0 {
+			b = append(b, ' ')
+		}
+
+		b = append(b, "le "...)
+
+		if math.IsInf(h.Bounds[i], 1) {
+			b = append(b, "+Inf"...)
+		} else {
+			b = strconv.AppendFloat(b, h.Bounds[i], 'f', -1, 64)
+		}
+
+		b = append(b, ": "...)
+		b = strconv.AppendUint(b, uint64(h.Counts[i]), 10)
+	}
+
+	b = append(b, ']')
+
+	return string(b)
+}
+
+// Encoded size of a metric value, excluding its key.
+func (v *MetricValue) size() int {
+	// Kind & type (1 byte) + unit length (1 byte) + unit
+	s := 2 + len(v.Unit)
+
+	if v.Type == HistogramMetric {
+		s += 1 + 12*v.Histogram.Len()
+	} else {
+		s += 8
+	}
+
+	return s
+}
+
+func metricTiming(d time.Duration) MetricValue {
+	return MetricValue{
+		Float: float64(d) / float64(time.Millisecond),
+		Kind:  MetricTiming,
+		Type:  FloatMetric,
+		Unit:  "ms",
+	}
+}
+
+func metricUnit(unit []string) string {
+	if unit != nil {
+		return truncate(unit[0], MaxMetricUnitSize)
+	}
+
+	return ""
+}
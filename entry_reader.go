@@ -27,7 +27,7 @@ func (r entryReader) Sev() Severity {
 }
 
 func (r entryReader) Time() time.Time {
-	return r.e.id.Time()
+	return r.e.id.Time().Add(time.Duration(r.e.nanos))
 }
 
 func (r entryReader) Tags() []string {
@@ -42,12 +42,16 @@ func (r entryReader) Meta() (keys []string, values []string) {
 	return r.e.metaKeys[:r.e.metaCount], r.e.metaValues[:r.e.metaCount]
 }
 
-func (r entryReader) Metrics() (keys []string, values []int32) {
+func (r entryReader) Metrics() (keys []string, values []MetricValue) {
 	return r.e.metricKeys[:r.e.metricCount], r.e.metricValues[:r.e.metricCount]
 }
 
-func (r entryReader) Trace() (paths []string, lines []uint16) {
-	return r.e.stackTracePaths[:r.e.stackTraceCount], r.e.stackTraceLines[:r.e.stackTraceCount]
+func (r entryReader) Trace() (paths []string, lines []uint32, funcs []string) {
+	return r.e.stackTracePaths[:r.e.stackTraceCount], r.e.stackTraceLines[:r.e.stackTraceCount], r.e.stackTraceFuncs[:r.e.stackTraceCount]
+}
+
+func (r entryReader) Attachments() (keys []string, values []string) {
+	return r.e.attachKeys[:r.e.attachCount], r.e.attachValues[:r.e.attachCount]
 }
 
 func (r entryReader) TTL() uint16 {
@@ -58,6 +62,19 @@ func (r entryReader) MetaTTL() uint16 {
 	return r.e.ttlMeta
 }
 
+func (r entryReader) TraceContext() TraceContext {
+	return r.e.traceCtx
+}
+
+func (r entryReader) ParentId() xid.ID {
+	return r.e.parentId
+}
+
+// Returns the identity of the process that emitted the entry, if known.
+func (r entryReader) Resource() *Resource {
+	return r.e.resource
+}
+
 func (r entryReader) HasId() bool {
 	return !r.e.id.IsNil()
 }
@@ -82,6 +99,53 @@ func (r entryReader) HasTrace() bool {
 	return r.e.stackTraceCount != 0
 }
 
+func (r entryReader) HasAttachments() bool {
+	return r.e.attachCount != 0
+}
+
+func (r entryReader) HasTraceContext() bool {
+	return !r.e.traceCtx.IsZero()
+}
+
+func (r entryReader) HasParent() bool {
+	return !r.e.parentId.IsNil()
+}
+
+// Returns the Ed25519 signature of the entry, if signed.
+func (r entryReader) Signature() []byte {
+	if r.e.flags&flagSignature == 0 {
+		return nil
+	}
+
+	return r.e.signature[:]
+}
+
+func (r entryReader) HasSignature() bool {
+	return r.e.flags&flagSignature != 0
+}
+
+func (r entryReader) HasChecksum() bool {
+	return r.e.flags&flagChecksum != 0
+}
+
+// Returns the stable fingerprint of the entry, for grouping. See `Entry.Fingerprint`.
+func (r entryReader) Fingerprint() uint64 {
+	return r.e.Fingerprint()
+}
+
+func (r entryReader) HasFingerprint() bool {
+	return r.e.flags&flagFingerprint != 0
+}
+
+// Returns which fields were truncated or dropped because of size or count limits.
+func (r entryReader) Truncated() Truncation {
+	return r.e.truncated
+}
+
+func (r entryReader) IsTruncated() bool {
+	return r.e.truncated != 0
+}
+
 func (r entryReader) FullTags() bool {
 	return r.e.tagsCount == MaxTagsCount
 }
@@ -1,5 +1,10 @@
 package logger
 
+import (
+	"strconv"
+	"strings"
+)
+
 type Severity uint8
 
 const (
@@ -12,3 +17,49 @@ const (
 	INFO
 	DEBUG
 )
+
+var severityNames = [...]string{
+	EMERG:   "emerg",
+	ALERT:   "alert",
+	CRIT:    "crit",
+	ERR:     "err",
+	WARNING: "warning",
+	NOTICE:  "notice",
+	INFO:    "info",
+	DEBUG:   "debug",
+}
+
+// Implements stringer interface
+func (s Severity) String() string {
+	if int(s) < len(severityNames) {
+		return severityNames[s]
+	}
+
+	return strconv.Itoa(int(s))
+}
+
+// Parses a severity from its name (case insensitive) or number.
+func ParseSeverity(str string) (Severity, error) {
+	for i := range severityNames {
+		if strings.EqualFold(str, severityNames[i]) {
+			return Severity(i), nil
+		}
+	}
+
+	if n, err := strconv.ParseUint(str, 10, 8); err == nil && n <= uint64(DEBUG) {
+		return Severity(n), nil
+	}
+
+	return 0, ErrInvalidSeverity
+}
+
+// Implements encoding.TextMarshaler
+func (s Severity) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// Implements encoding.TextUnmarshaler
+func (s *Severity) UnmarshalText(b []byte) (err error) {
+	*s, err = ParseSeverity(string(b))
+	return
+}
@@ -1,7 +1,15 @@
 package logger
 
 import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"math"
+	"strings"
 	"testing"
+	"time"
+	"unicode/utf8"
 
 	"github.com/rs/xid"
 )
@@ -68,3 +76,473 @@ func BenchmarkEntryXID(b *testing.B) {
 		e.Id(id)
 	}
 }
+
+func TestEntryMetrics(t *testing.T) {
+	var (
+		buf [MaxEntrySize]byte
+		e   Entry
+	)
+
+	e.Id(xid.New()).Msg("metrics").
+		MetricInt("bytes", 1<<40, "B").
+		MetricFloat("ratio", 0.25).
+		Counter("requests", 3).
+		Timing("latency", 1500*time.Microsecond).
+		Histogram("buckets", Histogram{
+			Bounds: []float64{10, 100, math.Inf(1)},
+			Counts: []uint32{5, 2, 1},
+		}, "ms")
+
+	size := e.Encode(buf[:])
+
+	var d Entry
+
+	if err := d.Decode(buf[:size]); err != nil {
+		t.Fatal(err)
+	}
+
+	keys, values := d.Read().Metrics()
+
+	if len(keys) != 5 {
+		t.Fatalf("expected 5 metrics, got %d", len(keys))
+	}
+
+	if values[0].Int != 1<<40 || values[0].Unit != "B" {
+		t.Errorf("unexpected int metric: %+v", values[0])
+	}
+
+	if values[1].Type != FloatMetric || values[1].Float != 0.25 {
+		t.Errorf("unexpected float metric: %+v", values[1])
+	}
+
+	if values[2].Kind != MetricCounter || values[2].Int != 3 {
+		t.Errorf("unexpected counter metric: %+v", values[2])
+	}
+
+	if values[3].Kind != MetricTiming || values[3].Float != 1.5 || values[3].Unit != "ms" {
+		t.Errorf("unexpected timing metric: %+v", values[3])
+	}
+
+	if h := values[4].Histogram; values[4].Kind != MetricGauge || h.Len() != 3 || h.Total() != 8 || !math.IsInf(h.Bounds[2], 1) {
+		t.Errorf("unexpected histogram metric: %+v", values[4])
+	}
+}
+
+func TestEntryLegacy(t *testing.T) {
+	var (
+		buf [MaxEntrySize]byte
+		e   Entry
+		d   Entry
+	)
+
+	// Entry in the layout of peers before v1.2-ack, with an int32 metric and a trace with a 16-bit line
+	id := xid.New()
+	legacy := []byte{0, 0, 0, 0, 0, 1}
+	legacy = append(legacy, id[:]...)
+	legacy = append(legacy, uint8(INFO), 2, 'h', 'i', 0, 0)
+	legacy = append(legacy, 1, 1, 'n', 0xff, 0xff, 0xff, 0xfb)
+	legacy = append(legacy, 0)
+	legacy = append(legacy, 1, 4, 'a', '.', 'g', 'o', 0x01, 0x02)
+	legacy = append(legacy, 0, 3)
+	legacy[1] = uint8(len(legacy))
+
+	if err := d.DecodeLegacyStrict(legacy); err != nil {
+		t.Fatal(err)
+	}
+
+	keys, values := d.Read().Metrics()
+	paths, lines, _ := d.Read().Trace()
+
+	if d.Read().Msg() != "hi" || len(keys) != 1 || values[0].Int != -5 || len(paths) != 1 || lines[0] != 0x0102 || d.Read().TTL() != 3 {
+		t.Errorf("unexpected legacy entry: %s", d.String())
+	}
+
+	if size := d.EncodeLegacy(buf[:]); string(buf[:size]) != string(legacy) {
+		t.Errorf("expected legacy encoding %v, got %v", legacy, buf[:size])
+	}
+
+	// Values that don't fit the legacy layout are converted or left out
+	e.Id(id).Msg("converted").
+		MetricInt("bytes", 1<<40).
+		MetricFloat("ratio", 2.5).
+		Histogram("buckets", Histogram{Bounds: []float64{10}, Counts: []uint32{1}}).
+		ManualTrace("main.go", 1<<20, "main.main").
+		Time(time.Now()).
+		Checksum(true)
+
+	size := e.EncodeLegacy(buf[:])
+
+	if err := d.DecodeLegacyStrict(buf[:size]); err != nil {
+		t.Fatal(err)
+	}
+
+	keys, values = d.Read().Metrics()
+	paths, lines, funcs := d.Read().Trace()
+
+	if len(keys) != 2 || values[0].Int != math.MaxInt32 || values[1].Int != 3 {
+		t.Errorf("unexpected legacy metrics: %v %+v", keys, values)
+	}
+
+	if len(paths) != 1 || lines[0] != math.MaxUint16 || funcs[0] != "" {
+		t.Errorf("unexpected legacy trace: %v %v %v", paths, lines, funcs)
+	}
+
+	if d.Read().HasChecksum() {
+		t.Error("expected no trailers in the legacy layout")
+	}
+}
+
+func TestEntrySubSecondTime(t *testing.T) {
+	var (
+		buf [MaxEntrySize]byte
+		e   Entry
+		d   Entry
+	)
+
+	ts := time.Date(2023, 5, 17, 12, 30, 15, 123456789, time.UTC)
+	size := e.Time(ts).Msg("time").Encode(buf[:])
+
+	if err := d.Decode(buf[:size]); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := d.Read().Time(); !got.Equal(ts) {
+		t.Errorf("expected %s, got %s", ts, got)
+	}
+}
+
+func TestEntryCorrelation(t *testing.T) {
+	var (
+		buf [MaxEntrySize]byte
+		e   Entry
+		d   Entry
+	)
+
+	tc, err := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parent := xid.New()
+	size := e.Id(xid.New()).Msg("correlated").TraceContext(tc).Parent(parent).Encode(buf[:])
+
+	if err := d.Decode(buf[:size]); err != nil {
+		t.Fatal(err)
+	}
+
+	r := d.Read()
+
+	if got := r.TraceContext().Traceparent(); got != "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01" {
+		t.Errorf("unexpected traceparent: %s", got)
+	}
+
+	if r.ParentId() != parent {
+		t.Errorf("expected parent %s, got %s", parent, r.ParentId())
+	}
+
+	if _, err := ParseTraceparent("00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01"); err != ErrInvalidTraceparent {
+		t.Errorf("expected uppercase trace ID to be rejected, got %v", err)
+	}
+}
+
+func TestEntryChecksum(t *testing.T) {
+	var (
+		buf [MaxEntrySize]byte
+		e   Entry
+		d   Entry
+	)
+
+	size := e.Id(xid.New()).Msg("checksummed").Meta("foo", "bar").Checksum(true).Encode(buf[:])
+
+	if err := d.Decode(buf[:size]); err != nil {
+		t.Fatal(err)
+	}
+
+	if !d.Read().HasChecksum() || d.Read().Msg() != "checksummed" {
+		t.Error("expected checksummed entry")
+	}
+
+	// Corrupt a byte of the meta value
+	buf[size-6] ^= 0xff
+
+	if err := d.Decode(buf[:size]); !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("expected checksum mismatch, got %v", err)
+	}
+}
+
+func TestEntrySignature(t *testing.T) {
+	var (
+		buf [MaxEntrySize]byte
+		e   Entry
+		d   Entry
+	)
+
+	pub, key, err := ed25519.GenerateKey(rand.Reader)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e.Reset()
+	size := e.Id(xid.New()).Msg("signed").Checksum(true).EncodeSigned(buf[:], key)
+
+	if err := VerifySignature(buf[:size], pub); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.Decode(buf[:size]); err != nil {
+		t.Fatal(err)
+	}
+
+	// The decoded entry must be verifiable after being encoded again
+	if err := d.Verify(pub); err != nil {
+		t.Fatal(err)
+	}
+
+	d.Msg("tampered")
+
+	if err := d.Verify(pub); err != ErrInvalidSignature {
+		t.Errorf("expected invalid signature, got %v", err)
+	}
+
+	if err := VerifySignature(buf[:size], nil); err != ErrInvalidSignature {
+		t.Errorf("expected invalid signature with a missing key, got %v", err)
+	}
+}
+
+func TestEntryString(t *testing.T) {
+	tests := []struct {
+		message  string
+		tags     []any
+		expected string
+	}{
+		{"user %s logged in", []any{"foo"}, "user foo logged in"},
+		{"%d items, %.2f kr, %q", []any{3, 9.5, "a b"}, `3 items, 9.50 kr, "a b"`},
+		{"%05d|%-4s|%x|%t", []any{42, "ab", 255, true}, "00042|ab  |ff|true"},
+		{"%d is not a number", []any{"abc"}, "abc is not a number"},
+		{"user {user} paid {amount} at 100%%", nil, "user foo@bar.baz paid 12.50 at 100%"},
+		{"{{user}} {missing} {not a key} %s", nil, "{user} {missing} {not a key} %s"},
+		{"{user} sent %s", []any{"tag"}, "foo@bar.baz sent tag"},
+		{"trailing %", nil, "trailing %"},
+		{"räksmörgås %s", []any{"ok"}, "räksmörgås ok"},
+	}
+
+	for _, test := range tests {
+		var e Entry
+		e.Reset()
+		e.Msg(test.message).Tag(test.tags...).Meta("user", "foo@bar.baz").Meta("amount", "12.50")
+
+		if str := e.String(); str != test.expected {
+			t.Errorf("%q: expected %q, got %q", test.message, test.expected, str)
+		}
+	}
+
+	if str := EscapeMessage("50% off {today}"); str != "50%% off {{today}}" {
+		t.Errorf("unexpected escaped message %q", str)
+	}
+}
+
+func TestEntryFingerprint(t *testing.T) {
+	var (
+		buf [MaxEntrySize]byte
+		a   Entry
+		b   Entry
+		c   Entry
+		d   Entry
+	)
+
+	a.Reset()
+	b.Reset()
+	c.Reset()
+	a.Msg("created user %s").Tag("a@example.com").ManualTrace("main.go", 10, "main.createUser")
+	b.Msg("created user %s").Tag("b@example.com").ManualTrace("main.go", 12, "main.createUser")
+	c.Msg("created user %s").Cat(2).ManualTrace("main.go", 10, "main.createUser")
+
+	if a.Fingerprint() != b.Fingerprint() {
+		t.Error("expected same fingerprint regardless of tags and line")
+	}
+
+	if a.Fingerprint() == c.Fingerprint() {
+		t.Error("expected different fingerprint for different category")
+	}
+
+	size := a.Id(xid.New()).IncludeFingerprint(true).Checksum(true).Encode(buf[:])
+
+	if err := d.Decode(buf[:size]); err != nil {
+		t.Fatal(err)
+	}
+
+	if r := d.Read(); !r.HasFingerprint() || r.Fingerprint() != a.Fingerprint() || r.Msg() != "created user %s" {
+		t.Errorf("unexpected decoded fingerprint %s", FormatFingerprint(r.Fingerprint()))
+	}
+}
+
+func TestEntryAttachmentChunks(t *testing.T) {
+	var (
+		buf   [MaxEntrySize]byte
+		e     Entry
+		chunk AttachmentChunk
+	)
+
+	value := strings.Repeat("0123456789", 20000)
+	e.Id(xid.New()).Attach("body", value)
+	assembled := make([]byte, 0, len(value))
+
+	for offset := 0; offset < len(value); {
+		var size int
+		size, offset = e.EncodeAttachment(buf[:], 0, offset)
+
+		if !IsAttachmentChunk(buf[:size]) {
+			t.Fatal("expected attachment chunk")
+		}
+
+		if err := chunk.Decode(buf[:size]); err != nil {
+			t.Fatal(err)
+		}
+
+		if chunk.Key != "body" || chunk.Id != e.id || int(chunk.Offset) != len(assembled) || int(chunk.Total) != len(value) {
+			t.Fatalf("unexpected chunk: %+v", chunk)
+		}
+
+		assembled = append(assembled, chunk.Data...)
+	}
+
+	if string(assembled) != value {
+		t.Error("reassembled value differs")
+	}
+}
+
+func TestEntryDecodeError(t *testing.T) {
+	var (
+		buf [MaxEntrySize]byte
+		e   Entry
+		d   Entry
+	)
+
+	e.Reset()
+	size := e.Id(xid.New()).Msg("räksmörgås").Meta("foo", "bar").Encode(buf[:])
+
+	// Cut the meta value short, and fix the size annotation
+	binary.BigEndian.PutUint16(buf[:], uint16(size-1))
+	err := d.Decode(buf[:size-1])
+
+	var decodeErr *DecodeError
+
+	if !errors.As(err, &decodeErr) || !errors.Is(err, ErrCorruptEntry) {
+		t.Fatalf("expected decode error, got %v", err)
+	}
+
+	if decodeErr.Section != "meta" || decodeErr.Expected != size || decodeErr.Actual != size-1 {
+		t.Errorf("unexpected decode error: %v", decodeErr)
+	}
+
+	// Make the message invalid UTF-8, which is only rejected in strict mode
+	size = e.Encode(buf[:])
+	buf[21] = 0xff
+
+	if err := d.Decode(buf[:size]); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.DecodeStrict(buf[:size]); !errors.Is(err, ErrInvalidUTF8) {
+		t.Errorf("expected invalid UTF-8, got %v", err)
+	}
+
+	// Unknown flags are only rejected in strict mode
+	size = e.Encode(buf[:])
+	buf[18] |= 0x08
+
+	if err := d.Decode(buf[:size]); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.DecodeStrict(buf[:size]); !errors.Is(err, ErrCorruptEntry) {
+		t.Errorf("expected unknown flag to be rejected, got %v", err)
+	}
+}
+
+// A length near the end of a max-sized entry must not wrap the bounds check.
+func TestEntryDecodeWrappingLength(t *testing.T) {
+	const metaSize = 65300
+	b := make([]byte, 0, MaxEntrySize)
+	b = append(b, 0, 0)                  // Size annotation
+	b = append(b, 0, 0, 0, 1)            // Bucket ID
+	b = append(b, xid.New().Bytes()...)  // Entry ID
+	b = append(b, byte(ERR), 0, 0, 0, 0) // Severity, message, category, tags and metrics
+	b = append(b, 1, 1, 'k')             // Meta count and key
+	b = binary.BigEndian.AppendUint16(b, metaSize)
+	b = append(b, make([]byte, metaSize)...)
+	b = append(b, 1, 255, 'a', 'b', 'c', 'd', 'e') // Stack trace with a path longer than the entry
+	binary.BigEndian.PutUint16(b, uint16(len(b)))
+
+	var d Entry
+
+	if err := d.Decode(b); !errors.Is(err, ErrCorruptEntry) {
+		t.Errorf("expected corrupt entry, got %v", err)
+	}
+}
+
+func FuzzEntryDecode(f *testing.F) {
+	var (
+		buf [MaxEntrySize]byte
+		e   Entry
+	)
+
+	e.Reset()
+	f.Add(buf[:e.Id(xid.New()).Msg("foo %s").Tag("bar").Encode(buf[:])])
+	f.Add(buf[:e.MetricInt("bytes", 42, "B").Meta("foo", "bar").ManualTrace("main.go", 1, "main.main").Checksum(true).Encode(buf[:])])
+
+	f.Fuzz(func(t *testing.T, b []byte) {
+		var d Entry
+
+		if len(b) >= 2 && len(b) <= MaxEntrySize {
+			binary.BigEndian.PutUint16(b, uint16(len(b)))
+		}
+
+		d.Decode(b)
+		d.DecodeStrict(b)
+	})
+}
+
+func TestEntryTruncation(t *testing.T) {
+	var (
+		buf [MaxEntrySize]byte
+		e   Entry
+		d   Entry
+	)
+
+	e.Reset()
+	e.Id(xid.New()).Msg("truncated").
+		Tag(strings.Repeat("ö", MaxTagSize), "b", "c", "d", "e", "f", "g", "h", "i").
+		Meta("foo", strings.Repeat("ö", MaxMetaValueSize))
+
+	size := e.Encode(buf[:])
+
+	if err := d.Decode(buf[:size]); err != nil {
+		t.Fatal(err)
+	}
+
+	r := d.Read()
+
+	// The meta value is truncated, but still too large to fit in the entry
+	if r.Truncated() != TruncatedTags|DroppedTags|TruncatedMeta|DroppedMeta {
+		t.Errorf("unexpected truncation: %s", r.Truncated())
+	}
+
+	if tags := r.Tags(); len(tags[0]) != MaxTagSize-1 || !utf8.ValidString(tags[0]) {
+		t.Errorf("expected tag to be truncated at a rune boundary, got %d bytes", len(tags[0]))
+	}
+
+	// Messages set directly are truncated too
+	e.Reset()
+	size = e.Id(xid.New()).Msg(strings.Repeat("x", 300)).Encode(buf[:])
+
+	if err := d.Decode(buf[:size]); err != nil {
+		t.Fatal(err)
+	}
+
+	if r = d.Read(); len(r.Msg()) != MaxMessageSize || r.Truncated() != TruncatedMessage {
+		t.Errorf("expected message to be truncated, got %d bytes: %s", len(r.Msg()), r.Truncated())
+	}
+}
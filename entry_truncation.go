@@ -0,0 +1,78 @@
+package logger
+
+import (
+	"strings"
+)
+
+// Bitmask of fields that were truncated or dropped because of size or count limits.
+type Truncation uint16
+
+const (
+	TruncatedMessage Truncation = 1 << iota
+	TruncatedTags
+	DroppedTags
+	TruncatedMetrics
+	DroppedMetrics
+	TruncatedMeta
+	DroppedMeta
+	TruncatedStackTrace
+	DroppedStackTrace
+	TruncatedAttachments
+	DroppedAttachments
+)
+
+var truncationNames = [...]string{
+	"truncated message",
+	"truncated tags",
+	"dropped tags",
+	"truncated metrics",
+	"dropped metrics",
+	"truncated meta",
+	"dropped meta",
+	"truncated stack trace",
+	"dropped stack trace",
+	"truncated attachments",
+	"dropped attachments",
+}
+
+// Returns whether any of the flags are set.
+func (t Truncation) Has(flags Truncation) bool {
+	return t&flags != 0
+}
+
+// Implements stringer interface
+func (t Truncation) String() string {
+	var names []string
+
+	for i := range truncationNames {
+		if t&(1<<i) != 0 {
+			names = append(names, truncationNames[i])
+		}
+	}
+
+	return strings.Join(names, ", ")
+}
+
+// Records that fields were truncated or dropped.
+func (e *Entry) setTruncated(flags Truncation) {
+	if flags != 0 {
+		e.truncated |= flags
+		e.incLevel(_13_Truncation)
+	}
+}
+
+// Truncates a string like `truncate` and records it with the flag. Entries created from
+// a logger get `PoolOptions.TruncationMarker` appended.
+func (e *Entry) truncate(str string, length int, flag Truncation) string {
+	if len(str) <= length {
+		return str
+	}
+
+	e.setTruncated(flag)
+
+	if e.logger != nil {
+		return truncateMarked(str, length, e.logger.pool.opt.TruncationMarker)
+	}
+
+	return truncate(str, length)
+}
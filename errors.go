@@ -8,5 +8,14 @@ var (
 	ErrInvalidSubjectKeyId = errors.New("invalid subject key ID")
 	ErrTooShort            = errors.New("entry too short")
 	ErrCorruptEntry        = errors.New("corrupt entry")
+	ErrChecksumMismatch    = errors.New("checksum mismatch")
+	ErrInvalidUTF8         = errors.New("invalid UTF-8")
+	ErrMissingSignature    = errors.New("missing signature")
+	ErrInvalidSignature    = errors.New("invalid signature")
 	ErrForbiddenBucket     = errors.New("forbidden bucket")
+	ErrInvalidTraceparent  = errors.New("invalid traceparent")
+	ErrClosed              = errors.New("closed")
+	ErrInvalidSeverity     = errors.New("invalid severity")
+	ErrFiltered            = errors.New("entry was filtered")
+	ErrUnsignedAttachment  = errors.New("unsigned attachment")
 )
@@ -23,11 +23,16 @@ func FormatEntry(e *logger.Entry, rowPrefix string) string {
 	f.write("STRING", e.String())
 	f.write("MSG", r.Msg())
 	f.write("TAGS", r.Tags())
+	f.write("FINGERPRINT", logger.FormatFingerprint(r.Fingerprint()))
 
 	keys, values := r.Meta()
 	f.write("META KEYS", keys)
 	f.write("META VALUES", values)
 
+	if r.IsTruncated() {
+		f.write("TRUNCATED", r.Truncated())
+	}
+
 	return b.String()
 }
 
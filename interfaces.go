@@ -18,3 +18,29 @@ type ClientCloser interface {
 	Client
 	Close(context.Context) error
 }
+
+// An error that decorates entries created from it, e.g. with tags, meta, category or severity.
+// Called for every error in the chain when an error is sent with `Pool.Send` or `Logger.Send`.
+type ErrorDecorator interface {
+	error
+	DecorateEntry(e *Entry)
+}
+
+// A client that buffers entries, and can wait until they have been sent.
+type ClientFlusher interface {
+	Client
+	Flush(context.Context) error
+}
+
+// A client with a full lifecycle: entries are buffered until flushed, and closing the client
+// sends any remaining entries before releasing its resources.
+type ClientLifecycle interface {
+	ClientFlusher
+	ClientCloser
+}
+
+// A client that sends the identity of the process, e.g. once per connection.
+type ClientIdentifier interface {
+	Client
+	Identify(Resource)
+}
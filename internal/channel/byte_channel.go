@@ -1,6 +1,7 @@
 package channel
 
 import (
+	"context"
 	"io"
 	"sync"
 )
@@ -177,6 +178,40 @@ func (ch *ByteChannel) WaitUntilEmpty() (err error) {
 	return
 }
 
+// Wait until channel is empty, or the context is done
+func (ch *ByteChannel) WaitUntilEmptyContext(ctx context.Context) (err error) {
+	done := make(chan struct{})
+	defer close(done)
+
+	// Wake up the waiting below when the context is done
+	go func() {
+		select {
+		case <-ctx.Done():
+			ch.mu.Lock()
+			ch.writeCond.Broadcast()
+			ch.mu.Unlock()
+		case <-done:
+		}
+	}()
+
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+
+	for !ch.empty() && !ch.closed {
+		if err = ctx.Err(); err != nil {
+			return
+		}
+
+		ch.writeCond.Wait()
+	}
+
+	if ch.closed {
+		return io.ErrClosedPipe
+	}
+
+	return
+}
+
 func (ch *ByteChannel) ReadToCallback(cb func([]byte) error, undoOnError bool) (err error) {
 	ch.mu.Lock()
 	defer ch.mu.Unlock()
@@ -0,0 +1,305 @@
+package logger
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var _ http.Handler = (*LevelRules)(nil)
+
+// A rule that overrides the min severity of matching entries, e.g. to enable DEBUG for a single
+// category or customer in production. All set conditions must match. Category rules match the
+// final category of entries, including any set with `Entry.Cat` or `Entry.Send`, so entries they
+// might enable are created and filtered when sent. Expiry is always checked against the wall
+// clock, regardless of `PoolOptions.Clock`.
+type LevelRule struct {
+	Id       uint32        `json:"id"`                 // Assigned when the rule is added
+	Category *uint8        `json:"category,omitempty"` // Category ID of the entry
+	Tag      string        `json:"tag,omitempty"`      // Tag of the logger or the entry, e.g. a customer ID
+	Logger   string        `json:"logger,omitempty"`   // Name of the logger, or a prefix ending with "*"
+	Severity Severity      `json:"severity"`           // Min severity of matching entries
+	Expires  time.Time     `json:"expires"`            // Zero never expires
+	TTL      time.Duration `json:"-"`                  // Sets `Expires` relative to when the rule is added
+}
+
+func (rule *LevelRule) expired(now time.Time) bool {
+	return !rule.Expires.IsZero() && now.After(rule.Expires)
+}
+
+// Returns whether the rule matches entries of the category, with any tags passed when the entry
+// was created or of the entry itself.
+func (rule *LevelRule) matches(l *Logger, categoryId uint8, tags []any, entryTags []string) bool {
+	if rule.Category != nil && *rule.Category != categoryId {
+		return false
+	}
+
+	if rule.Logger != "" {
+		if prefix, ok := strings.CutSuffix(rule.Logger, "*"); ok {
+			if !strings.HasPrefix(l.name, prefix) {
+				return false
+			}
+		} else if rule.Logger != l.name {
+			return false
+		}
+	}
+
+	if rule.Tag != "" {
+		for i := range l.tags {
+			if l.tags[i] == rule.Tag {
+				return true
+			}
+		}
+
+		for i := range tags {
+			if stringify(tags[i]) == rule.Tag {
+				return true
+			}
+		}
+
+		for i := range entryTags {
+			if entryTags[i] == rule.Tag {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	return true
+}
+
+// Registry of rules consulted by loggers before creating entries. Rules can be changed at any
+// time, e.g. with `ServeHTTP` or `ToggleOnSignal`. The zero value is ready to use.
+type LevelRules struct {
+	rules  []LevelRule
+	mu     sync.RWMutex
+	count  atomic.Int32 // Number of rules, to skip locking when there are none
+	nextId uint32
+}
+
+// Adds a rule and returns its ID.
+func (r *LevelRules) Add(rule LevelRule) uint32 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	r.prune(now)
+
+	if rule.TTL > 0 && rule.Expires.IsZero() {
+		rule.Expires = now.Add(rule.TTL)
+	}
+
+	r.nextId++
+	rule.Id = r.nextId
+	r.rules = append(r.rules, rule)
+	r.count.Store(int32(len(r.rules)))
+
+	return rule.Id
+}
+
+// Removes a rule by its ID. Returns whether an unexpired rule was removed.
+func (r *LevelRules) Remove(id uint32) (removed bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i := range r.rules {
+		if r.rules[i].Id == id {
+			removed = !r.rules[i].expired(time.Now())
+			r.rules = append(r.rules[:i], r.rules[i+1:]...)
+			break
+		}
+	}
+
+	r.count.Store(int32(len(r.rules)))
+	return
+}
+
+// Removes all rules.
+func (r *LevelRules) Clear() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.rules = nil
+	r.count.Store(0)
+}
+
+// Returns all unexpired rules.
+func (r *LevelRules) List() []LevelRule {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.prune(time.Now())
+	return append([]LevelRule{}, r.rules...)
+}
+
+func (r *LevelRules) prune(now time.Time) {
+	rules := r.rules[:0]
+
+	for i := range r.rules {
+		if !r.rules[i].expired(now) {
+			rules = append(rules, r.rules[i])
+		}
+	}
+
+	r.rules = rules
+	r.count.Store(int32(len(r.rules)))
+}
+
+// Returns the most verbose severity of all rules matching the logger, category and tags, if any.
+func (r *LevelRules) match(l *Logger, categoryId uint8, tags []any, entryTags []string) (severity Severity, ok bool) {
+	if r.count.Load() == 0 {
+		return
+	}
+
+	now := time.Now()
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for i := range r.rules {
+		rule := &r.rules[i]
+
+		if rule.expired(now) || !rule.matches(l, categoryId, tags, entryTags) {
+			continue
+		}
+
+		if !ok || rule.Severity > severity {
+			severity = rule.Severity
+			ok = true
+		}
+	}
+
+	return
+}
+
+// Returns whether any category rule would enable entries of the severity from the logger, if
+// they were given the rule's category before being sent.
+func (r *LevelRules) enablesCategory(l *Logger, severity Severity, tags []any) bool {
+	if r.count.Load() == 0 {
+		return false
+	}
+
+	now := time.Now()
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for i := range r.rules {
+		rule := &r.rules[i]
+
+		if rule.Category != nil && severity <= rule.Severity && !rule.expired(now) && rule.matches(l, *rule.Category, tags, nil) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Implements http.Handler, to list and change rules at runtime:
+//
+//	GET     Lists all rules
+//	POST    Adds a rule with a required severity, e.g. {"category": 3, "severity": "debug", "ttl": "15m"}
+//	DELETE  Removes the rule with the ID in the `id` query parameter, or all rules
+func (r *LevelRules) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, r.List())
+
+	case http.MethodPost:
+		var body struct {
+			LevelRule
+			Severity *Severity `json:"severity"` // A missing severity would otherwise be EMERG
+			TTL      string    `json:"ttl"`
+		}
+
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if body.Severity == nil || *body.Severity > DEBUG {
+			http.Error(w, ErrInvalidSeverity.Error(), http.StatusBadRequest)
+			return
+		}
+
+		body.LevelRule.Severity = *body.Severity
+
+		if body.TTL != "" {
+			ttl, err := time.ParseDuration(body.TTL)
+
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			body.LevelRule.TTL = ttl
+		}
+
+		body.LevelRule.Id = r.Add(body.LevelRule)
+		writeJSON(w, http.StatusCreated, body.LevelRule)
+
+	case http.MethodDelete:
+		if str := req.URL.Query().Get("id"); str != "" {
+			id, err := strconv.ParseUint(str, 10, 32)
+
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			if !r.Remove(uint32(id)) {
+				http.Error(w, "rule not found", http.StatusNotFound)
+				return
+			}
+		} else {
+			r.Clear()
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		w.Header().Set("Allow", "GET, POST, DELETE")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// Toggles the rule whenever the process receives any of the signals, e.g. `syscall.SIGUSR1`
+// to enable DEBUG for all loggers for a while, without a redeploy. Stops listening when the
+// context is done.
+func (r *LevelRules) ToggleOnSignal(ctx context.Context, rule LevelRule, sig ...os.Signal) {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, sig...)
+
+	go func() {
+		var id uint32
+		defer signal.Stop(ch)
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+
+			case <-ch:
+				if id != 0 && r.Remove(id) {
+					id = 0
+				} else {
+					id = r.Add(rule)
+				}
+			}
+		}
+	}()
+}
@@ -2,20 +2,34 @@ package logger
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
 
 	"github.com/rs/xid"
 )
 
 type Logger struct {
-	tags         []string
-	metaKeys     []string
-	metaValues   []string
-	metricKeys   []string
-	metricValues []int32
-	pool         *Pool
-	ttlEntry     uint16
-	ttlMeta      uint16
-	categoryId   uint8
+	tags          []string
+	metaKeys      []string
+	metaValues    []string
+	metricKeys    []string
+	metricValues  []MetricValue
+	pool          *Pool
+	ctx           context.Context
+	sampler       Sampler
+	dedup         *Deduplicator
+	name          string
+	minSeverity   atomic.Int32
+	traceCtx      TraceContext
+	parentId      xid.ID
+	ttlEntry      uint16
+	ttlMeta       uint16
+	categoryId    uint8
+	traceSeverity Severity
+	truncated     Truncation
+	noTrace       bool
+	traceCaller   bool
 }
 
 func (l *Logger) Reset() {
@@ -27,6 +41,17 @@ func (l *Logger) Reset() {
 	l.ttlEntry = l.pool.opt.DefaultEntryTTL
 	l.ttlMeta = l.pool.opt.DefaultMetaTTL
 	l.categoryId = 0
+	l.traceCtx = TraceContext{}
+	l.parentId = xid.NilID()
+	l.traceSeverity = l.pool.opt.StackTraceSeverity
+	l.noTrace = l.pool.opt.NoStackTrace
+	l.traceCaller = l.pool.opt.TraceCaller
+	l.truncated = 0
+	l.name = ""
+	l.minSeverity.Store(inheritSeverity)
+	l.sampler = l.pool.opt.Sampler
+	l.dedup = nil
+	l.ctx = nil
 }
 
 func (l *Logger) Drop() {
@@ -73,28 +98,153 @@ func (l *Logger) Debug(message string, tags ...any) (e *Entry) {
 	return l.log(DEBUG, message, tags)
 }
 
+// Sends an EMERG entry, waits for the client to flush and close, and exits the process. See `Entry.Fatal`.
+// The entry is never filtered nor sampled.
+func (l *Logger) Fatal(message string, tags ...any) {
+	l.traced(EMERG, message, tags, 1).Fatal()
+}
+
+// Sends a CRIT entry, waits for the client to flush, and panics with the entry. See `Entry.Panic`.
+// The entry is never filtered nor sampled.
+func (l *Logger) Panic(message string, tags ...any) {
+	l.traced(CRIT, message, tags, 1).Panic()
+}
+
+// Must only be called directly from exported methods, as the stack trace skips exactly one level.
 func (l *Logger) log(severity Severity, message string, tags []any) (e *Entry) {
+	ok, recheck := l.admits(severity, tags)
+
+	if !ok || !l.sample(severity, message) {
+		return l.filtered(severity, message, tags)
+	}
+
+	e = l.traced(severity, message, tags, 2)
+	e.recheck = recheck
+	return
+}
+
+// Returns a no-op entry in place of a filtered or sampled entry. Entries of ERR or higher severity are often
+// returned as errors (e.g. `return log.Err(...)`), so they get a no-op entry of their own that
+// still carries the message and tags. Other entries share the pool's no-op entry.
+func (l *Logger) filtered(severity Severity, message string, tags []any) (e *Entry) {
+	if severity > ERR {
+		return l.pool.noop
+	}
+
+	e = l.entry(severity, message)
+
+	if tags != nil {
+		e.Tag(tags...)
+	}
+
+	e.noop = true
+	return
+}
+
+// Like `log`, but for errors, which aren't sampled until their message has been parsed (see
+// `Entry.sample`). Must only be called directly from exported methods.
+func (l *Logger) logError() (e *Entry) {
+	ok, recheck := l.admits(ERR, nil)
+
+	if !ok {
+		return l.pool.noop
+	}
+
+	e = l.traced(ERR, "", nil, 2)
+	e.recheck = recheck
+	return
+}
+
+// Acquires an entry with any context from the logger, tags and automatic stack trace. The stack
+// trace skips the number of levels above the caller.
+func (l *Logger) traced(severity Severity, message string, tags []any, skip int) (e *Entry) {
+	e = l.entry(severity, message)
+
+	if tags != nil {
+		e.Tag(tags...)
+	}
+
+	if l.noTrace {
+		return
+	}
+
+	if severity <= l.traceSeverity {
+		e.addStackTrace(skip, MaxStackTraceCount)
+	} else if l.traceCaller {
+		e.addStackTrace(skip, 1)
+	}
+
+	return
+}
+
+// Acquires an entry with any context from the logger, but without tags and stack trace.
+func (l *Logger) entry(severity Severity, message string) (e *Entry) {
 	e = l.pool.Entry()
 	e.bucketId = l.pool.opt.BucketId
 	e.logger = l
-	e.id = xid.NewWithTime(l.pool.client.Now())
+	now := l.pool.opt.Clock.Now()
+	e.id = xid.NewWithTime(now)
+	e.setNanos(subSecond(now, l.pool.opt.TimePrecision))
 	e.severity = severity
-	e.message = truncate(message, MaxMessageSize)
+	e.message = e.truncate(message, MaxMessageSize, TruncatedMessage)
 	e.ttlEntry = l.ttlEntry
 	e.ttlMeta = l.ttlMeta
 	e.categoryId = l.categoryId
 	e.incLevel(_4_CategoryId)
+	e.Checksum(l.pool.opt.Checksum)
+	e.IncludeFingerprint(l.pool.opt.Fingerprint)
 
-	if tags != nil {
-		e.Tag(tags...)
+	if !l.traceCtx.IsZero() || !l.parentId.IsNil() {
+		e.traceCtx = l.traceCtx
+		e.parentId = l.parentId
+		e.incLevel(_12_Correlation)
 	}
 
 	return
 }
 
-// Send an error to the log
+// Creates an error entry formatted like `fmt.Errorf`. Any errors wrapped with `%w` become the
+// cause of the entry, and numbers and quoted strings become tags like in `Send`.
+func (l *Logger) Errorf(format string, args ...any) (e *Entry) {
+	err := fmt.Errorf(format, args...)
+	enabled, recheck := l.admits(ERR, nil)
+
+	// Filtered and sampled errors still get the message and cause, as they are often returned as
+	// errors
+	if enabled {
+		e = l.traced(ERR, "", nil, 1)
+	} else {
+		e = l.entry(ERR, "")
+	}
+
+	parseErrorString(e, err.Error())
+
+	switch err := err.(type) {
+	case interface{ Unwrap() error }:
+		e.cause = err.Unwrap()
+
+	case interface{ Unwrap() []error }:
+		e.cause = errors.Join(err.Unwrap()...)
+	}
+
+	// Errors are sampled on their parsed message, and suppressed errors aren't released to the
+	// pool, as they are returned
+	if !enabled || !l.sample(e.severity, e.message) {
+		e.noop = true
+	}
+
+	e.recheck = recheck
+	return
+}
+
+// Send an error to the log, with any causes in its chain recorded as meta. See `ErrorDecorator`
+// for how errors can decorate the entry.
 func (l *Logger) Send(err error) xid.ID {
-	return l.pool.Send(err)
+	if e, ok := err.(*Entry); ok {
+		return e.Send()
+	}
+
+	return l.logError().captureError(err).Send()
 }
 
 // Set the default category ID for this logger. All entries created from this logger will have
@@ -107,15 +257,16 @@ func (l *Logger) Cat(categoryId uint8) *Logger {
 // Set tags for this logger. All entries created from this logger will have these tags appended.
 func (l *Logger) Tag(tags ...any) *Logger {
 	for i := range tags {
-		if len(l.tags) >= MaxTagsCount {
-			break
-		}
-
 		if tags[i] == "" {
 			continue
 		}
 
-		l.tags = append(l.tags, truncate(stringify(tags[i]), MaxTagSize))
+		if len(l.tags) >= MaxTagsCount {
+			l.truncated |= DroppedTags
+			break
+		}
+
+		l.tags = append(l.tags, l.truncate(stringify(tags[i]), MaxTagSize, TruncatedTags))
 	}
 
 	return l
@@ -127,20 +278,229 @@ func (e *Logger) MetaBlob(value any) *Logger {
 
 // Set meta data for this logger. All entries created from this logger will have these meta data appended.
 func (l *Logger) Meta(key string, value any) *Logger {
-	l.metaKeys = append(l.metaKeys, truncate(key, MaxMetaKeySize))
-	l.metaValues = append(l.metaValues, truncate(stringify(value), MaxMetaValueSize))
+	l.metaKeys = append(l.metaKeys, l.truncate(key, MaxMetaKeySize, TruncatedMeta))
+	l.metaValues = append(l.metaValues, l.truncate(stringify(value), MaxMetaValueSize, TruncatedMeta))
 
 	return l
 }
 
 // Set metrics for this logger. All entries created from this logger will have these metrics appended.
 func (l *Logger) Metric(key string, value int32) *Logger {
-	l.metricKeys = append(l.metricKeys, truncate(key, MaxMetaKeySize))
+	return l.AddMetric(key, MetricValue{Int: int64(value)})
+}
+
+// Set a 64-bit integer gauge for this logger, with an optional unit.
+func (l *Logger) MetricInt(key string, value int64, unit ...string) *Logger {
+	return l.AddMetric(key, MetricValue{Int: value, Unit: metricUnit(unit)})
+}
+
+// Set a float gauge for this logger, with an optional unit.
+func (l *Logger) MetricFloat(key string, value float64, unit ...string) *Logger {
+	return l.AddMetric(key, MetricValue{Float: value, Type: FloatMetric, Unit: metricUnit(unit)})
+}
+
+// Set a counter for this logger, with an optional unit.
+func (l *Logger) Counter(key string, value int64, unit ...string) *Logger {
+	return l.AddMetric(key, MetricValue{Int: value, Kind: MetricCounter, Unit: metricUnit(unit)})
+}
+
+// Set a metric of any kind and type for this logger.
+func (l *Logger) AddMetric(key string, value MetricValue) *Logger {
+	value.Unit = l.truncate(value.Unit, MaxMetricUnitSize, TruncatedMetrics)
+	l.metricKeys = append(l.metricKeys, l.truncate(key, MaxMetaKeySize, TruncatedMetrics))
 	l.metricValues = append(l.metricValues, value)
 
 	return l
 }
 
+// Set the W3C trace context for this logger. All entries created from this logger will be
+// correlated with the trace.
+func (l *Logger) TraceContext(tc TraceContext) *Logger {
+	l.traceCtx = tc
+	return l
+}
+
+// Set the parent entry ID for this logger. All entries created from this logger will reference
+// the parent entry, e.g. the entry that started a job.
+func (l *Logger) Parent(id xid.ID) *Logger {
+	l.parentId = id
+	return l
+}
+
+// Create a new logger that inherits any context from this logger, extracts the trace context
+// from `ctx` with `PoolOptions.TraceExtractor`, and adds any tags, meta and category carried by
+// `ctx` (see `ContextWithTags`). Entries created from the logger are sent with `ctx`.
+func (l *Logger) Ctx(ctx context.Context) (l2 *Logger) {
+	l2 = l.Logger()
+	l2.ctx = ctx
+
+	if tc, ok := l.pool.opt.TraceExtractor(ctx); ok {
+		l2.traceCtx = tc
+	}
+
+	f := fieldsFromContext(ctx)
+
+	if f.hasCategory {
+		l2.categoryId = f.categoryId
+	}
+
+	if f.tags != nil {
+		l2.Tag(f.tags...)
+	}
+
+	for i := range f.metaKeys {
+		l2.Meta(f.metaKeys[i], f.metaValues[i])
+	}
+
+	return
+}
+
+// Returns the context that entries created from this logger are sent with.
+func (l *Logger) context() context.Context {
+	if l.ctx != nil {
+		return l.ctx
+	}
+
+	return context.Background()
+}
+
+// Value of a logger's min severity when it uses the pool's
+const inheritSeverity = -1
+
+// Set the severity at or above which entries created from this logger are sent. Overrides
+// `PoolOptions.MinSeverity` and `Pool.SetMinSeverity`. Safe to call at any time. Entries of less
+// severity are no-ops that never touch the pool.
+func (l *Logger) MinSeverity(severity Severity) *Logger {
+	l.minSeverity.Store(int32(severity))
+	return l
+}
+
+// Returns whether entries of the severity are sent, e.g. to guard expensive arguments.
+func (l *Logger) Enabled(severity Severity) bool {
+	return l.enabled(severity, nil)
+}
+
+// Any matching level rule overrides the logger's and pool's min severity.
+func (l *Logger) enabled(severity Severity, tags []any) bool {
+	return l.enabledCat(severity, l.categoryId, tags, nil)
+}
+
+// Like `enabled`, but for another category than the logger's, and any tags of an entry.
+func (l *Logger) enabledCat(severity Severity, categoryId uint8, tags []any, entryTags []string) bool {
+	if sev, ok := l.pool.opt.LevelRules.match(l, categoryId, tags, entryTags); ok {
+		return severity <= sev
+	}
+
+	threshold := l.minSeverity.Load()
+
+	if threshold == inheritSeverity {
+		threshold = l.pool.minSeverity.Load()
+	}
+
+	return int32(severity) <= threshold
+}
+
+// Returns whether an entry of the severity should be created. Entries that would otherwise be
+// filtered are created if a category rule would enable them once categorized (see `Entry.Cat`),
+// in which case level rules must be consulted again when they are sent (see `Entry.Send`).
+func (l *Logger) admits(severity Severity, tags []any) (ok bool, recheck bool) {
+	if l.enabled(severity, tags) {
+		return true, false
+	}
+
+	if l.pool.opt.LevelRules.enablesCategory(l, severity, tags) {
+		return true, true
+	}
+
+	return false, false
+}
+
+// Returns whether the entry should be sent, once its final category is known. Level rules are
+// only consulted again if the entry was created speculatively (see `admits`), or if its category
+// changed and there are any rules.
+func (l *Logger) admitsEntry(e *Entry) bool {
+	if !e.recheck && (e.categoryId == l.categoryId || l.pool.opt.LevelRules.count.Load() == 0) {
+		return true
+	}
+
+	return l.enabledCat(e.severity, e.categoryId, nil, e.tags[:e.tagsCount])
+}
+
+// Set the name of this logger, e.g. "billing.invoices", that level rules can match. Loggers
+// created from this logger inherit the name.
+func (l *Logger) Name(name string) *Logger {
+	l.name = name
+	return l
+}
+
+// Set the sampler that decides which entries created from this logger are sent, or nil to send
+// all. Overrides `PoolOptions.Sampler`. The pool drains the sampler on flush until it's released
+// with `Pool.ReleaseSampler`.
+func (l *Logger) Sampler(s Sampler) *Logger {
+	l.sampler = s
+	l.pool.registerSampler(s)
+	return l
+}
+
+// Set the deduplicator that collapses identical entries created from this logger, or nil to
+// send all. Loggers created from this logger inherit the deduplicator. The pool flushes the
+// deduplicator on flush until it's released with `Pool.ReleaseDedup`.
+func (l *Logger) Dedup(d *Deduplicator) *Logger {
+	l.dedup = d
+	l.pool.registerDedup(d)
+	return l
+}
+
+// Consults the logger's sampler, if any, and sends a summary of any entries it suppressed
+// before this one.
+func (l *Logger) sample(severity Severity, message string) bool {
+	if l.sampler == nil {
+		return true
+	}
+
+	ok, suppressed := l.sampler.Sample(severity, message, l.pool.opt.Clock.Now())
+
+	if suppressed != 0 {
+		l.sendSuppressed(severity, message, suppressed)
+	}
+
+	return ok
+}
+
+// Sends a summary of entries suppressed by a sampler.
+func (l *Logger) sendSuppressed(severity Severity, message string, suppressed uint64) {
+	var e *Entry
+
+	if message == "" {
+		e = l.entry(severity, "Suppressed %s entries").Tag(suppressed)
+	} else {
+		e = l.entry(severity, "Suppressed %s entries before: %s").Tag(suppressed, message)
+	}
+
+	e.MetricInt("suppressed", int64(suppressed)).Send()
+}
+
+// Set the severity at or above which entries created from this logger will get a stack
+// trace automatically. Overrides `PoolOptions.StackTraceSeverity`.
+func (l *Logger) TraceSeverity(severity Severity) *Logger {
+	l.traceSeverity = severity
+	l.noTrace = false
+	return l
+}
+
+// Disable automatic stack traces and callers for this logger. Overrides `PoolOptions.NoStackTrace`.
+func (l *Logger) NoTrace() *Logger {
+	l.noTrace = true
+	return l
+}
+
+// Set whether entries below the stack trace severity should get the caller's frame recorded.
+// Overrides `PoolOptions.TraceCaller`.
+func (l *Logger) TraceCaller(enabled bool) *Logger {
+	l.traceCaller = enabled
+	return l
+}
+
 // Set the default TTL for this logger. All entries created from this logger will have
 // this TTL if not overridden.
 func (l *Logger) TTL(days int) *Logger {
@@ -166,10 +526,38 @@ func (l *Logger) Logger() (l2 *Logger) {
 	l2.tags = append(l2.tags, l.tags...)
 	l2.ttlEntry = l.ttlEntry
 	l2.ttlMeta = l.ttlMeta
+	l2.traceCtx = l.traceCtx
+	l2.parentId = l.parentId
+	l2.traceSeverity = l.traceSeverity
+	l2.noTrace = l.noTrace
+	l2.traceCaller = l.traceCaller
+	l2.truncated = l.truncated
+	l2.name = l.name
+	l2.minSeverity.Store(l.minSeverity.Load())
+	l2.sampler = l.sampler
+	l2.dedup = l.dedup
+	l2.ctx = l.ctx
 	return l2
 }
 
-// Gracefully close the client.
+// Truncates a string like `truncate` and records it with the flag, so that it's reported on
+// all entries created from this logger.
+func (l *Logger) truncate(str string, length int, flag Truncation) string {
+	if len(str) <= length {
+		return str
+	}
+
+	l.truncated |= flag
+	return truncateMarked(str, length, l.pool.opt.TruncationMarker)
+}
+
+// Wait until all entries have been sent by the client, including any duplicates collapsed by
+// deduplicators. See `Pool.Flush`.
+func (l *Logger) Flush(ctx context.Context) error {
+	return l.pool.Flush(ctx)
+}
+
+// Gracefully close the client. Any entries sent afterwards are refused. See `Pool.CloseClient`.
 func (l *Logger) CloseClient(ctx context.Context) error {
 	return l.pool.CloseClient(ctx)
 }
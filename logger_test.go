@@ -1,7 +1,16 @@
 package logger
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/kpango/fastime"
 )
@@ -21,3 +30,881 @@ func BenchmarkBareboneLog(b *testing.B) {
 		logger.Debug("hello").Trace().Send()
 	}
 }
+
+type entryRecorder struct {
+	entries []*Entry
+	ctxs    []context.Context
+	mu      sync.Mutex
+}
+
+func (r *entryRecorder) ProcessEntry(ctx context.Context, e *Entry) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.entries = append(r.entries, e)
+	r.ctxs = append(r.ctxs, ctx)
+	return nil
+}
+
+func (r *entryRecorder) count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.entries)
+}
+
+func (r *entryRecorder) Now() time.Time {
+	return time.Now()
+}
+
+func TestAutomaticStackTrace(t *testing.T) {
+	var rec entryRecorder
+	pool, err := NewPool(&rec, PoolOptions{TraceCaller: true})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	log := pool.Logger()
+	log.Err("traced").Send()
+	log.Debug("caller only").Send()
+	log.NoTrace().Err("untraced").Send()
+
+	_, _, funcs := rec.entries[0].Read().Trace()
+
+	if len(funcs) < 2 || funcs[0] != "github.com/webbmaffian/go-logger.TestAutomaticStackTrace" {
+		t.Errorf("expected full trace starting at caller, got %v", funcs)
+	}
+
+	if _, _, funcs = rec.entries[1].Read().Trace(); len(funcs) != 1 || funcs[0] != "github.com/webbmaffian/go-logger.TestAutomaticStackTrace" {
+		t.Errorf("expected caller only, got %v", funcs)
+	}
+
+	if rec.entries[2].Read().HasTrace() {
+		t.Error("expected no trace")
+	}
+}
+
+// Small enough to be inlined, so that its frame shares a program counter with its caller's.
+func logInlined(log *Logger) *Entry {
+	return log.Debug("inlined")
+}
+
+func TestAutomaticStackTraceInlined(t *testing.T) {
+	var rec entryRecorder
+	pool, err := NewPool(&rec, PoolOptions{TraceCaller: true})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	logInlined(pool.Logger()).Send()
+
+	if _, _, funcs := rec.entries[0].Read().Trace(); len(funcs) != 1 || funcs[0] != "github.com/webbmaffian/go-logger.logInlined" {
+		t.Errorf("expected caller only, got %v", funcs)
+	}
+}
+
+func TestAutomaticStackTraceCapped(t *testing.T) {
+	var rec entryRecorder
+	pool, err := NewPool(&rec)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var recurse func(depth int)
+	recurse = func(depth int) {
+		if depth == 0 {
+			pool.Logger().Err("deep").Send()
+			return
+		}
+
+		recurse(depth - 1)
+	}
+
+	recurse(MaxStackTraceCount * 2)
+	r := rec.entries[0].Read()
+
+	// Automatic stack traces are capped by design, which isn't reported as dropped
+	if paths, _, _ := r.Trace(); len(paths) != MaxStackTraceCount || r.Truncated() != 0 {
+		t.Errorf("expected %d frames without truncation, got %d: %s", MaxStackTraceCount, len(paths), r.Truncated())
+	}
+}
+
+type categorizedError struct {
+	err error
+}
+
+func (err categorizedError) Error() string {
+	return "categorized: " + err.err.Error()
+}
+
+func (err categorizedError) Unwrap() error {
+	return err.err
+}
+
+func (err categorizedError) DecorateEntry(e *Entry) {
+	e.Cat(7).Sev(CRIT)
+}
+
+func TestSendErrorChain(t *testing.T) {
+	var rec entryRecorder
+	pool, err := NewPool(&rec, PoolOptions{BucketId: 123})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cause := errors.Join(ErrTooShort, ErrCorruptEntry)
+	id := pool.Send(fmt.Errorf("decoding entry 42: %w", categorizedError{cause}))
+
+	e := rec.entries[0]
+	r := e.Read()
+
+	if id.IsNil() || r.Id() != id || r.Bucket() != 123 {
+		t.Errorf("expected ID and bucket to be set, got %s and %d", r.Id(), r.Bucket())
+	}
+
+	if r.Cat() != 7 || r.Sev() != CRIT {
+		t.Errorf("expected entry to be decorated, got category %d and severity %d", r.Cat(), r.Sev())
+	}
+
+	keys, values := r.Meta()
+	meta := make(map[string]string, len(keys))
+
+	for i := range keys {
+		meta[keys[i]] = values[i]
+	}
+
+	if meta["error.type"] != "*fmt.wrapError" || meta["cause.1.type"] != "logger.categorizedError" || meta["cause.3"] != ErrTooShort.Error() || meta["cause.4"] != ErrCorruptEntry.Error() {
+		t.Errorf("unexpected error chain: %v", meta)
+	}
+}
+
+func TestErrorf(t *testing.T) {
+	var rec entryRecorder
+	pool, err := NewPool(&rec)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e := pool.Logger().Errorf("failed to read entry %d: %w", 42, ErrTooShort)
+
+	if !errors.Is(e, ErrTooShort) {
+		t.Error("expected the entry to wrap the cause")
+	}
+
+	if e.String() != "failed to read entry 42: "+ErrTooShort.Error() || e.Read().Tags()[0] != "42" {
+		t.Errorf("unexpected message %q with tags %v", e.Read().Msg(), e.Read().Tags())
+	}
+
+	e.Send()
+	keys, values := e.Read().Meta()
+
+	if len(keys) != 2 || keys[0] != "cause.1" || values[0] != ErrTooShort.Error() {
+		t.Errorf("expected cause to be recorded as meta, got %v = %v", keys, values)
+	}
+}
+
+func TestRecover(t *testing.T) {
+	var rec entryRecorder
+	pool, err := NewPool(&rec)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	log := pool.Logger()
+
+	func() {
+		defer log.Recover()
+		var m map[string]int
+		m["foo"] = 1
+	}()
+
+	func() {
+		defer func() {
+			if r := recover(); r != ErrTooShort {
+				t.Errorf("expected re-panic with the same value, got %v", r)
+			}
+		}()
+
+		defer log.Recover(true)
+		panic(ErrTooShort)
+	}()
+
+	if len(rec.entries) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(rec.entries))
+	}
+
+	r := rec.entries[0].Read()
+	_, _, funcs := r.Trace()
+
+	if r.Sev() != CRIT || !strings.HasPrefix(rec.entries[0].String(), "Panic: assignment to entry in nil map") {
+		t.Errorf("unexpected entry: %s", rec.entries[0])
+	}
+
+	if len(funcs) == 0 || funcs[0] != "github.com/webbmaffian/go-logger.TestRecover.func1" {
+		t.Errorf("expected trace starting at the panic, got %v", funcs)
+	}
+
+	if r := rec.entries[1].Read(); r.Sev() != EMERG || !errors.Is(rec.entries[1], ErrTooShort) {
+		t.Errorf("expected EMERG entry wrapping the panic value, got %s", rec.entries[1])
+	}
+
+	// Deep panics are capped like automatic stack traces
+	var recurse func(depth int)
+	recurse = func(depth int) {
+		if depth == 0 {
+			panic("deep")
+		}
+
+		recurse(depth - 1)
+	}
+
+	func() {
+		defer log.Recover()
+		recurse(MaxStackTraceCount * 2)
+	}()
+
+	r = rec.entries[2].Read()
+
+	if paths, _, _ := r.Trace(); len(paths) != MaxStackTraceCount || r.Truncated() != 0 {
+		t.Errorf("expected %d frames without truncation, got %d: %s", MaxStackTraceCount, len(paths), r.Truncated())
+	}
+}
+
+func TestFatal(t *testing.T) {
+	var (
+		rec  entryRecorder
+		code int
+	)
+
+	pool, err := NewPool(&rec, PoolOptions{ExitFunc: func(c int) { code = c }})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	log := pool.Logger()
+	log.Fatal("shutting down")
+
+	if code != 1 || len(rec.entries) != 1 || rec.entries[0].Read().Sev() != EMERG {
+		t.Errorf("expected an EMERG entry and exit code 1, got %d entries and exit code %d", len(rec.entries), code)
+	}
+
+	// Entries without a pool exit with the default
+	defaultExit := DefaultExitFunc
+	DefaultExitFunc = func(c int) { code = c + 1 }
+	defer func() { DefaultExitFunc = defaultExit }()
+
+	var e Entry
+	e.Reset()
+	e.Msg("no pool").Fatal()
+
+	if code != 2 {
+		t.Errorf("expected default exit func to be called, got exit code %d", code)
+	}
+
+	defer func() {
+		if e, ok := recover().(*Entry); !ok || e.Read().Msg() != "out of %s" || e.Read().Sev() != CRIT {
+			t.Errorf("expected panic with the entry, got %v", e)
+		}
+	}()
+
+	log.Panic("out of %s", "memory")
+}
+
+func TestFatalFiltered(t *testing.T) {
+	var (
+		rec  entryRecorder
+		code int
+	)
+
+	newLogger := func() *Logger {
+		rec.entries = nil
+		code = 0
+		pool, err := NewPool(&rec, PoolOptions{
+			MinSeverity: INFO,
+			Sampler:     NewProbabilitySampler(map[Severity]float64{EMERG: 0, CRIT: 0}),
+			ExitFunc:    func(c int) { code = c },
+		})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return pool.Logger()
+	}
+
+	newLogger().Debug("filtered").Fatal()
+
+	if code != 1 || len(rec.entries) != 0 {
+		t.Errorf("expected exit code 1 without entries, got %d entries and exit code %d", len(rec.entries), code)
+	}
+
+	// Fatal and panic entries are never filtered nor sampled
+	newLogger().Fatal("shutting down")
+
+	if code != 1 || len(rec.entries) != 1 {
+		t.Errorf("expected exit code 1 with an entry, got %d entries and exit code %d", len(rec.entries), code)
+	}
+
+	log := newLogger()
+
+	func() {
+		defer func() {
+			if r := recover(); r != ErrFiltered {
+				t.Errorf("expected panic with ErrFiltered, got %v", r)
+			}
+		}()
+
+		log.Debug("filtered").Panic()
+	}()
+
+	defer func() {
+		if e, ok := recover().(*Entry); !ok || e.Read().Msg() != "out of %s" {
+			t.Errorf("expected panic with the entry, got %v", e)
+		}
+	}()
+
+	log.Panic("out of %s", "memory")
+}
+
+func TestFilteredErrors(t *testing.T) {
+	var rec entryRecorder
+	pool, err := NewPool(&rec, PoolOptions{MinSeverity: CRIT})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	log := pool.Logger()
+	cause := errors.New("connection refused")
+
+	// Filtered errors are still usable as errors, without being sent
+	if err := log.Errorf("failed to charge %s: %w", "customer-42", cause); err.Error() != "failed to charge customer-42: connection refused" || !errors.Is(err, cause) {
+		t.Errorf("unexpected filtered error: %q", err.Error())
+	}
+
+	if err := log.Err("failed to charge %s", "customer-42"); err.Error() != "failed to charge customer-42" {
+		t.Errorf("unexpected filtered error: %q", err.Error())
+	}
+
+	if log.Err("failed").Send(); len(rec.entries) != 0 {
+		t.Errorf("expected filtered errors not to be sent, got %d entries", len(rec.entries))
+	}
+}
+
+func TestPoolRefusesEntriesAfterClose(t *testing.T) {
+	var rec entryRecorder
+	pool, err := NewPool(&rec)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	log := pool.Logger()
+	log.Info("before close").Send()
+
+	if err := log.CloseClient(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := log.CloseClient(context.Background()); err != ErrClosed {
+		t.Errorf("expected ErrClosed, got %v", err)
+	}
+
+	if id := log.Info("after close").Send(); !id.IsNil() || len(rec.entries) != 1 {
+		t.Errorf("expected entry to be refused, got ID %s and %d entries", id, len(rec.entries))
+	}
+}
+
+func TestStdLogger(t *testing.T) {
+	var rec entryRecorder
+	pool, err := NewPool(&rec)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	std := NewStdLogger(pool.Logger())
+	std.Print("http: TLS handshake error from 10.0.0.1: EOF")
+	std.Print("ERROR: disk 95% full\n\tat /dev/sda1\n\tat /dev/sdb1")
+	std.Print("[warn] slow query")
+
+	if len(rec.entries) != 3 {
+		t.Fatalf("expected 3 entries, got %d", len(rec.entries))
+	}
+
+	for i, exp := range [...]struct {
+		message  string
+		severity Severity
+	}{
+		{"http: TLS handshake error from 10.0.0.1: EOF", INFO},
+		{"ERROR: disk 95% full", ERR},
+		{"[warn] slow query", WARNING},
+	} {
+		if e := rec.entries[i]; e.String() != exp.message || e.Read().Sev() != exp.severity {
+			t.Errorf("expected %q with severity %d, got %q with severity %d", exp.message, exp.severity, e, e.Read().Sev())
+		}
+	}
+
+	if _, values := rec.entries[1].Read().Meta(); len(values) != 1 || values[0] != "\tat /dev/sda1\n\tat /dev/sdb1" {
+		t.Errorf("expected continuation lines as meta, got %q", values)
+	}
+}
+
+func TestMinSeverity(t *testing.T) {
+	var rec entryRecorder
+	pool, err := NewPool(&rec, PoolOptions{MinSeverity: INFO})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	log := pool.Logger()
+
+	if log.Debug("filtered").Meta("foo", "bar").Tag("baz").Send(); len(rec.entries) != 0 {
+		t.Fatal("expected DEBUG to be filtered")
+	}
+
+	if pool.noop.Read().HasMeta() || pool.noop.Read().HasTags() {
+		t.Error("expected the no-op entry to be untouched")
+	}
+
+	debug := log.Logger().MinSeverity(DEBUG)
+	debug.Debug("sent").Send()
+	pool.SetMinSeverity(WARNING)
+	log.Info("filtered").Send()
+	log.Warning("sent").Send()
+
+	if len(rec.entries) != 2 || !debug.Enabled(DEBUG) || log.Enabled(INFO) {
+		t.Errorf("expected 2 entries, got %d", len(rec.entries))
+	}
+}
+
+func TestPoolSendReusesLogger(t *testing.T) {
+	pool, err := NewPool(&dummyWriter{clock: fastime.New()}, PoolOptions{MinSeverity: CRIT})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Filtered errors must not acquire a logger that is never released
+	if allocs := testing.AllocsPerRun(100, func() { pool.Send(ErrTooShort) }); allocs != 0 {
+		t.Errorf("expected no allocations, got %v", allocs)
+	}
+}
+
+func BenchmarkFilteredLog(b *testing.B) {
+	pool, err := NewPool(&dummyWriter{clock: fastime.New()}, PoolOptions{MinSeverity: INFO})
+
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	logger := pool.Logger()
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		logger.Debug("hello").Meta("foo", "bar").Send()
+	}
+}
+
+func TestLevelRules(t *testing.T) {
+	var rec entryRecorder
+	pool, err := NewPool(&rec, PoolOptions{MinSeverity: INFO})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rules := pool.LevelRules()
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"category": 3, "severity": "debug", "ttl": "1m"}`))
+	w := httptest.NewRecorder()
+	rules.ServeHTTP(w, req)
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected rule to be created, got %d: %s", w.Code, w.Body)
+	}
+
+	for _, body := range []string{`{"category": 4}`, `{"category": 4, "severity": "8"}`, `{"category": 4, "severity": 8}`} {
+		w = httptest.NewRecorder()
+		rules.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body)))
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("expected %s to be rejected, got %d", body, w.Code)
+		}
+	}
+
+	rules.Add(LevelRule{Tag: "customer-42", Severity: DEBUG})
+	rules.Add(LevelRule{Logger: "billing.*", Severity: WARNING})
+	rules.Add(LevelRule{Severity: DEBUG, Expires: time.Now().Add(-time.Second)})
+
+	log := pool.Logger()
+	log.Debug("filtered").Send()
+	log.Logger().Cat(3).Debug("category").Send()
+	log.Debug("tag", "customer-42").Send()
+	log.Logger().Name("billing.invoices").Info("filtered by name").Send()
+
+	if len(rec.entries) != 2 || rec.entries[0].Read().Msg() != "category" || rec.entries[1].Read().Msg() != "tag" {
+		t.Errorf("unexpected entries: %v", rec.entries)
+	}
+
+	if list := rules.List(); len(list) != 3 || list[0].Expires.IsZero() {
+		t.Errorf("expected 3 unexpired rules, got %+v", list)
+	}
+
+	// Expiry doesn't depend on the clock of the pool
+	rec.entries = nil
+	future, err := NewPool(&rec, PoolOptions{MinSeverity: INFO, LevelRules: rules, Clock: &testClock{now: time.Now().Add(time.Hour)}})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	future.Logger().Cat(3).Debug("category").Send()
+
+	if len(rec.entries) != 1 {
+		t.Errorf("expected rule to apply regardless of clock, got %d entries", len(rec.entries))
+	}
+
+	// Category rules match the final category of entries
+	rec.entries = nil
+	rules.Add(LevelRule{Category: &[]uint8{5}[0], Severity: WARNING})
+	log.Debug("entry category").Send(3)
+	log.Debug("other category").Cat(4).Send()
+	log.Debug("uncategorized").Send()
+	log.Logger().Cat(3).Info("muted").Send(5)
+	log.Send(categorizedError{ErrTooShort}) // Decorated as category 7
+	log.Notice("recategorized").Send(5)
+
+	if len(rec.entries) != 2 || rec.entries[0].Read().Msg() != "entry category" || rec.entries[1].Read().Cat() != 7 {
+		t.Errorf("unexpected entries: %v", rec.entries)
+	}
+}
+
+func TestSampler(t *testing.T) {
+	now := time.Now()
+	s := NewFirstThenEverySampler(2, 3, time.Minute)
+	var sent []uint64
+
+	for i := 0; i < 8; i++ {
+		if ok, suppressed := s.Sample(INFO, "hot", now); ok {
+			sent = append(sent, suppressed)
+		}
+	}
+
+	// 1, 2, 5, 8 are sent
+	if fmt.Sprint(sent) != "[0 0 2 2]" {
+		t.Errorf("unexpected suppressed counts: %v", sent)
+	}
+
+	if ok, _ := s.Sample(INFO, "cold", now); !ok {
+		t.Error("expected other template to be sent")
+	}
+
+	if ok, suppressed := s.Sample(INFO, "hot", now.Add(time.Minute)); !ok || suppressed != 0 {
+		t.Errorf("expected new interval, got %v, %d", ok, suppressed)
+	}
+
+	tb := NewTokenBucketSampler(1, 2)
+
+	for i, expected := range []bool{true, true, false, false} {
+		if ok, _ := tb.Sample(INFO, "hot", now); ok != expected {
+			t.Errorf("token %d: expected %v", i, expected)
+		}
+	}
+
+	if ok, suppressed := tb.Sample(INFO, "hot", now.Add(time.Second)); !ok || suppressed != 2 {
+		t.Errorf("expected refilled token and 2 suppressed, got %v, %d", ok, suppressed)
+	}
+
+	var rec entryRecorder
+	pool, err := NewPool(&rec, PoolOptions{Sampler: NewProbabilitySampler(map[Severity]float64{DEBUG: 0})})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	log := pool.Logger()
+	log.Debug("sampled").Send()
+	log.Debug("sampled").Send()
+	log.Sampler(nil).Debug("unsampled").Send()
+	log.Sampler(NewFirstThenEverySampler(1, 2, time.Minute))
+
+	for i := 0; i < 3; i++ {
+		log.Info("every other").Send()
+	}
+
+	if len(rec.entries) != 4 {
+		t.Fatalf("expected 4 entries, got %d", len(rec.entries))
+	}
+
+	summary := rec.entries[2].Read()
+
+	if summary.Msg() != "Suppressed %s entries before: %s" || fmt.Sprint(summary.Tags()) != "[1 every other]" {
+		t.Errorf("unexpected summary: %s %v", summary.Msg(), summary.Tags())
+	}
+}
+
+func TestSamplerErrors(t *testing.T) {
+	var rec entryRecorder
+	pool, err := NewPool(&rec, PoolOptions{Sampler: NewFirstThenEverySampler(1, 0, time.Minute)})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	log := pool.Logger()
+	cause := errors.New("card declined")
+	log.Send(fmt.Errorf("failed to charge customer 42: %w", cause))
+
+	// Errors are sampled on their parsed template, but suppressed errors are still usable as errors
+	if err := log.Errorf("failed to charge customer %d: %w", 43, cause); err.Error() != "failed to charge customer 43: card declined" || !errors.Is(err, cause) {
+		t.Errorf("unexpected suppressed error: %q", err.Error())
+	} else {
+		err.Send()
+	}
+
+	pool.Send(fmt.Errorf("failed to charge customer 44: %w", cause))
+	log.Err("timeout after %ds", 5).Send()
+
+	if err := log.Err("timeout after %ds", 10); err.Error() != "timeout after 10s" {
+		t.Errorf("unexpected suppressed error: %q", err.Error())
+	}
+
+	log.Send(errors.New("connection refused"))
+
+	if len(rec.entries) != 3 || rec.entries[2].Read().Msg() != "connection refused" {
+		t.Fatalf("expected 3 entries, got %v", rec.entries)
+	}
+
+	// Pending counts are reported on flush, as no more entries of the templates are sent
+	for i := 0; i < 2; i++ {
+		if err := pool.Flush(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(rec.entries) != 5 {
+		t.Fatalf("expected 2 summaries after flush, got %d entries", len(rec.entries))
+	}
+
+	summaries := []string{fmt.Sprint(rec.entries[3].Read().Tags()), fmt.Sprint(rec.entries[4].Read().Tags())}
+	sort.Strings(summaries)
+
+	if fmt.Sprint(summaries) != "[[1 timeout after %ds] [2 failed to charge customer %s: card declined]]" {
+		t.Errorf("unexpected summaries: %v", summaries)
+	}
+}
+
+func TestDedup(t *testing.T) {
+	var rec entryRecorder
+	pool, err := NewPool(&rec)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dedup := NewDeduplicator(time.Hour)
+	log := pool.Logger().Dedup(dedup)
+
+	for i := 0; i < 3; i++ {
+		if id := log.Err("failed to charge %s", "customer-42").Send(); id.IsNil() != (i != 0) {
+			t.Errorf("expected a nil ID only for duplicates, got %s for entry %d", id, i)
+		}
+	}
+
+	log.Err("failed to charge %s", "customer-43").Send()
+	log.Logger().Cat(2).Err("failed to charge %s", "customer-42").Send()
+
+	if len(rec.entries) != 3 {
+		t.Fatalf("expected 3 entries before flush, got %d", len(rec.entries))
+	}
+
+	if err := log.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rec.entries) != 4 {
+		t.Fatalf("expected collapsed entry after flush, got %d", len(rec.entries))
+	}
+
+	r := rec.entries[3].Read()
+	keys, values := r.Metrics()
+
+	if r.Tags()[0] != "customer-42" || len(keys) != 1 || keys[0] != "occurrences" || values[0].Int != 2 {
+		t.Errorf("unexpected collapsed entry: %v %v %v", r.Tags(), keys, values)
+	}
+
+	if metaKeys, _ := r.Meta(); fmt.Sprint(metaKeys) != "[first_seen last_seen]" {
+		t.Errorf("unexpected meta: %v", metaKeys)
+	}
+}
+
+type testClock struct {
+	now time.Time
+}
+
+func (c *testClock) Now() time.Time {
+	return c.now
+}
+
+func TestDedupPending(t *testing.T) {
+	var rec entryRecorder
+	clock := &testClock{now: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}
+	pool, err := NewPool(&rec, PoolOptions{Clock: clock})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	log := pool.Logger().Dedup(NewDeduplicator(time.Hour))
+
+	// Duplicates must be kept even if the entries are released after being sent
+	for i := 0; i < 3; i++ {
+		e := log.Err("failed to charge %s", "customer-42").Meta("attempt", i)
+		e.Send()
+		e.Drop()
+		clock.now = clock.now.Add(time.Second)
+	}
+
+	// Closing the pool sends the collapsed duplicate before refusing entries
+	if err := pool.CloseClient(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rec.entries) != 2 {
+		t.Fatalf("expected collapsed entry on close, got %d entries", len(rec.entries))
+	}
+
+	r := rec.entries[1].Read()
+	keys, values := r.Meta()
+
+	if fmt.Sprint(r.Tags()) != "[customer-42]" || fmt.Sprint(keys, values) != "[attempt first_seen last_seen] [2 2024-01-01T12:00:00Z 2024-01-01T12:00:02Z]" {
+		t.Errorf("unexpected collapsed entry: %v %v %v", r.Tags(), keys, values)
+	}
+}
+
+func TestReleaseSamplerAndDedup(t *testing.T) {
+	var rec entryRecorder
+	pool, err := NewPool(&rec)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sampler := NewFirstThenEverySampler(1, 10, time.Minute)
+	dedup := NewDeduplicator(time.Hour)
+	log := pool.Logger().Sampler(sampler)
+	log.Info("hot").Send()
+	log.Info("hot").Send()
+	log.Sampler(nil).Dedup(dedup)
+	log.Err("timeout").Send()
+	log.Err("timeout").Send()
+
+	// Releasing reports what's pending, and the pool stops tracking them
+	pool.ReleaseSampler(sampler)
+	pool.ReleaseDedup(dedup)
+
+	if rec.count() != 4 || len(pool.samplers) != 0 || len(pool.dedups) != 0 {
+		t.Fatalf("expected 4 entries and nothing registered, got %d, %d, %d", rec.count(), len(pool.samplers), len(pool.dedups))
+	}
+
+	if err := pool.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if rec.count() != 4 {
+		t.Errorf("expected nothing more on flush, got %d entries", rec.count())
+	}
+}
+
+func TestDedupExpiry(t *testing.T) {
+	var rec entryRecorder
+	pool, err := NewPool(&rec)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	log := pool.Logger().Dedup(NewDeduplicator(10 * time.Millisecond))
+
+	for i := 0; i < 2; i++ {
+		log.Err("timeout").Send()
+		log.Err("refused").Send()
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+
+	for rec.count() != 4 {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected 4 entries when windows close, got %d", rec.count())
+		}
+
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	// Tracking starts over when too many unique entries are tracked
+	dedup := NewDeduplicator(time.Hour)
+	log.Dedup(dedup)
+	log.Err("timeout").Send()
+	log.Err("timeout").Send()
+
+	for i := 0; i < MaxDedupKeys; i++ {
+		log.Err("unique %d", i).Send()
+	}
+
+	dedup.mu.Lock()
+	defer dedup.mu.Unlock()
+
+	if len(dedup.entries) != 1 || rec.count() != 4+1+MaxDedupKeys+1 {
+		t.Errorf("expected reset, got %d tracked and %d entries", len(dedup.entries), rec.count())
+	}
+}
+
+func TestContext(t *testing.T) {
+	var rec entryRecorder
+	pool, err := NewPool(&rec)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type requestKey struct{}
+
+	ctx := context.WithValue(context.Background(), requestKey{}, "req-1")
+	ctx = ContextWithTags(ctx, "customer-42")
+	ctx = ContextWithMeta(ctx, "route", "/invoices")
+	parent := ctx
+	ctx = ContextWithCategory(ContextWithTags(ctx, "admin"), 4)
+	ContextWithTags(parent, "other")
+
+	log := pool.Logger().Tag("api")
+	ctx = WithContext(ctx, log.Ctx(ctx))
+
+	l, ok := FromContext(ctx)
+
+	if !ok {
+		t.Fatal("expected logger in context")
+	}
+
+	l.Info("created invoice for %s", "foo").Send()
+	r := rec.entries[0].Read()
+	keys, values := r.Meta()
+
+	if r.Cat() != 4 || fmt.Sprint(r.Tags()) != "[foo api customer-42 admin]" || fmt.Sprint(keys, values) != "[route] [/invoices]" {
+		t.Errorf("unexpected entry: %d %v %v %v", r.Cat(), r.Tags(), keys, values)
+	}
+
+	if rec.ctxs[0].Value(requestKey{}) != "req-1" {
+		t.Error("expected the caller's context to be forwarded to the client")
+	}
+
+	if _, ok := FromContext(context.Background()); ok {
+		t.Error("expected no logger in empty context")
+	}
+}
@@ -0,0 +1,85 @@
+package peer
+
+import (
+	"strings"
+
+	"github.com/rs/xid"
+	"github.com/webbmaffian/go-logger"
+)
+
+// Reassembles attachment chunks sent before an entry. Only the attachments of one entry are
+// kept at a time, as the client sends the chunks of an entry and the entry itself without any
+// chunks of other entries in between (see `TlsClient.ProcessEntry`).
+type attachmentAssembler struct {
+	id       xid.ID
+	keys     [logger.MaxAttachmentCount]string
+	values   [logger.MaxAttachmentCount][]byte
+	received [logger.MaxAttachmentCount]int // Offset of the next expected chunk
+	count    int
+	maxSize  int
+}
+
+func (a *attachmentAssembler) add(c *logger.AttachmentChunk) {
+	if c.Id != a.id {
+		a.reset()
+		a.id = c.Id
+	}
+
+	i := a.index(c.Key)
+
+	if i < 0 {
+		if a.count >= logger.MaxAttachmentCount || int(c.Total) > a.maxSize {
+			return
+		}
+
+		i = a.count
+
+		// The key references the connection's buffer, which is overwritten by the next frame
+		a.keys[i] = strings.Clone(c.Key)
+		a.values[i] = make([]byte, c.Total)
+		a.count++
+	}
+
+	// Chunks are sent in order, so any duplicate, overlapping or out-of-order chunk is ignored
+	if len(a.values[i]) != int(c.Total) || int(c.Offset) != a.received[i] {
+		return
+	}
+
+	a.received[i] += copy(a.values[i][c.Offset:], c.Data)
+}
+
+// Attaches all completely received attachments to the entry, if they belong to it.
+func (a *attachmentAssembler) attachTo(e *logger.Entry) {
+	if a.count == 0 || e.Read().Id() != a.id {
+		return
+	}
+
+	for i := 0; i < a.count; i++ {
+		if a.received[i] == len(a.values[i]) {
+			e.Attach(a.keys[i], a.values[i])
+		}
+	}
+
+	a.reset()
+}
+
+func (a *attachmentAssembler) index(key string) int {
+	for i := 0; i < a.count; i++ {
+		if a.keys[i] == key {
+			return i
+		}
+	}
+
+	return -1
+}
+
+func (a *attachmentAssembler) reset() {
+	for i := 0; i < a.count; i++ {
+		a.keys[i] = ""
+		a.values[i] = nil
+		a.received[i] = 0
+	}
+
+	a.id = xid.NilID()
+	a.count = 0
+}
@@ -7,11 +7,11 @@ import (
 	"errors"
 	"io"
 	"net"
+	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/jpillora/backoff"
-	"github.com/kpango/fastime"
 	"github.com/webbmaffian/go-logger"
 	"github.com/webbmaffian/go-logger/auth"
 	"github.com/webbmaffian/go-logger/internal/channel"
@@ -21,19 +21,36 @@ const (
 	protoV10    = "v1.0"
 	protoV10Ack = "v1.0-ack"
 	protoV11Ack = "v1.1-ack"
+	protoV12Ack = "v1.2-ack" // Like v1.1-ack, but the client identifies itself first, and entries have typed metrics and named stack frames
 )
 
-var _ logger.Client = (*TlsClient)(nil)
+var (
+	_ logger.Client           = (*TlsClient)(nil)
+	_ logger.ClientIdentifier = (*TlsClient)(nil)
+	_ logger.ClientLifecycle  = (*TlsClient)(nil)
+)
 
 type TlsClient struct {
 	ctxCancel context.CancelFunc
 	conn      atomic.Pointer[tls.Conn]
+	resource  atomic.Pointer[logger.Resource]
 	dialer    tls.Dialer
 	ch        *channel.ByteChannel
-	clock     fastime.Fastime
+	clock     logger.Clock
 	opt       TlsClientOptions
 	backoff   backoff.Backoff
 	write     func(func([]byte)) bool
+	attachMu  sync.Mutex // Keeps frames of other entries from coming between chunks and their entry
+	legacy    *legacyEncoder
+	ackMu     sync.Mutex
+	acks      []int // Frames acknowledged by each response, as attachment chunks aren't sent to legacy servers
+	skipped   int   // Attachment chunks not sent since the last frame
+}
+
+// Servers before v1.2-ack expect the legacy layout of entries, and don't know attachments.
+type legacyEncoder struct {
+	buf   [logger.MaxEntrySize]byte
+	entry logger.Entry
 }
 
 type TlsClientOptions struct {
@@ -45,6 +62,9 @@ type TlsClientOptions struct {
 	WriteMethod      WriteMethod      // What should happen if the buffer is full. Default: WriteOrReplace (replace oldest)
 	ServerAckTimeout time.Duration
 	ErrorHandler     func(error)
+	Clock            logger.Clock  // Clock used for timestamping entries and deadlines. Default: a clock with `ClockPrecision`
+	ClockPrecision   time.Duration // Precision of the default clock. Timestamps are also truncated to `PoolOptions.TimePrecision`, so the coarser of the two wins. Default: time.Second
+	SignEntries      bool          // Sign every entry with the private key, so that it can be verified later. Attachments aren't signed.
 }
 
 func (opt *TlsClientOptions) setDefaults() {
@@ -75,11 +95,15 @@ func NewTlsClient(opt TlsClientOptions) (c *TlsClient, err error) {
 
 	ctx, cancel := context.WithCancel(context.Background())
 
+	if opt.Clock == nil {
+		opt.Clock = logger.NewClock(ctx, opt.ClockPrecision)
+	}
+
 	c = &TlsClient{
 		ctxCancel: cancel,
 		ch:        channel.NewByteChannel(opt.BufferSize, logger.MaxEntrySize),
 		opt:       opt,
-		clock:     fastime.New().StartTimerD(ctx, time.Second),
+		clock:     opt.Clock,
 		backoff: backoff.Backoff{
 			Factor: 2,
 			Min:    time.Second,
@@ -107,14 +131,21 @@ func (c *TlsClient) WaitUntilSent() error {
 	return c.ch.WaitUntilEmpty()
 }
 
-// Close the client gracefully. Will block until closed, or the context got cancelled.
-func (c *TlsClient) CloseWithContext(ctx context.Context) (err error) {
+// Wait until all written entries have been sent and acknowledged, or the context got cancelled.
+func (c *TlsClient) Flush(ctx context.Context) error {
+	return c.ch.WaitUntilEmptyContext(ctx)
+}
+
+// Close the client gracefully: no more entries are accepted, and all written entries are sent
+// before the client is closed. Will block until closed, or the context got cancelled - in which
+// case the client is closed forcefully.
+func (c *TlsClient) Close(ctx context.Context) (err error) {
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
 	go func() {
 		<-ctx.Done()
-		c.Close()
+		c.ForceClose()
 	}()
 
 	// Ensure that no more entries are written
@@ -128,11 +159,11 @@ func (c *TlsClient) CloseGracefully(timeout time.Duration) (err error) {
 	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
 
-	return c.CloseWithContext(ctx)
+	return c.Close(ctx)
 }
 
-// Closes forcefully
-func (c *TlsClient) Close() error {
+// Closes forcefully, without waiting for written entries to be sent.
+func (c *TlsClient) ForceClose() error {
 	c.ctxCancel()
 	c.ch.Close()
 	return c.disconnect()
@@ -142,10 +173,40 @@ func (c *TlsClient) Now() time.Time {
 	return c.clock.Now()
 }
 
+// Sets the identity that will be sent to the server once per connection.
+func (c *TlsClient) Identify(r logger.Resource) {
+	c.resource.Store(&r)
+}
+
 func (c *TlsClient) ProcessEntry(_ context.Context, e *logger.Entry) (err error) {
-	c.write(func(b []byte) {
-		e.Encode(b)
-	})
+	// Attachments are sent in chunks before the entry, so that they can be reassembled
+	// by the server once the entry arrives.
+	keys, values := e.Read().Attachments()
+
+	if len(keys) != 0 {
+		c.attachMu.Lock()
+		defer c.attachMu.Unlock()
+	}
+
+	for i := range keys {
+		for offset := 0; offset < len(values[i]); {
+			if !c.write(func(b []byte) {
+				_, offset = e.EncodeAttachment(b, i, offset)
+			}) {
+				break
+			}
+		}
+	}
+
+	if c.opt.SignEntries {
+		c.write(func(b []byte) {
+			e.EncodeSigned(b, c.opt.PrivateKey.Ed25519())
+		})
+	} else {
+		c.write(func(b []byte) {
+			e.Encode(b)
+		})
+	}
 
 	return
 }
@@ -180,6 +241,16 @@ func (c *TlsClient) processEntry(b []byte) error {
 
 	b = b[:size]
 
+	if c.legacy != nil {
+		var err error
+
+		if b, err = c.encodeLegacy(b); b == nil || err != nil {
+			return err
+		}
+
+		size = len(b)
+	}
+
 	for bytesWritten < size {
 		s, err := c.conn.Load().Write(b[bytesWritten:])
 		bytesWritten += s
@@ -223,11 +294,48 @@ func (c *TlsClient) processResponses() {
 		}
 
 		if n != 0 {
-			c.ch.Ack()
+			for n := c.framesAcked(); n > 0; n-- {
+				c.ch.Ack()
+			}
 		}
 	}
 }
 
+// Transcodes an encoded entry to the legacy layout. Attachment chunks are skipped, and
+// acknowledged along with the next frame.
+func (c *TlsClient) encodeLegacy(b []byte) ([]byte, error) {
+	c.ackMu.Lock()
+	defer c.ackMu.Unlock()
+
+	if logger.IsAttachmentChunk(b) {
+		c.skipped++
+		return nil, nil
+	}
+
+	if err := c.legacy.entry.Decode(b, true); err != nil {
+		return nil, err
+	}
+
+	c.acks = append(c.acks, c.skipped+1)
+	c.skipped = 0
+	size := c.legacy.entry.EncodeLegacy(c.legacy.buf[:])
+	return c.legacy.buf[:size], nil
+}
+
+// Returns the number of frames acknowledged by a response.
+func (c *TlsClient) framesAcked() (n int) {
+	c.ackMu.Lock()
+	defer c.ackMu.Unlock()
+
+	if len(c.acks) == 0 {
+		return 1
+	}
+
+	n = c.acks[0]
+	c.acks = c.acks[1:]
+	return
+}
+
 func (c *TlsClient) setupDialer() {
 	cert := c.opt.Certificate.TLS(c.opt.PrivateKey)
 	c.dialer = tls.Dialer{
@@ -238,7 +346,7 @@ func (c *TlsClient) setupDialer() {
 			RootCAs:            c.opt.RootCa.X509Pool(),
 			MinVersion:         tls.VersionTLS13,
 			MaxVersion:         tls.VersionTLS13,
-			NextProtos:         []string{protoV11Ack, protoV10},
+			NextProtos:         []string{protoV12Ack, protoV11Ack, protoV10},
 			ClientSessionCache: tls.NewLRUClientSessionCache(8),
 			Time:               c.clock.Now,
 		},
@@ -298,7 +406,25 @@ func (c *TlsClient) connect(ctx context.Context) (err error) {
 		return errors.New("expected TLS connection")
 	}
 
-	if tlsConn.ConnectionState().NegotiatedProtocol != protoV11Ack {
+	c.ackMu.Lock()
+	c.acks = nil
+	c.skipped = 0
+	c.ackMu.Unlock()
+
+	switch tlsConn.ConnectionState().NegotiatedProtocol {
+	case protoV11Ack:
+		if c.legacy == nil {
+			c.legacy = new(legacyEncoder)
+		}
+	case protoV12Ack:
+		c.legacy = nil
+
+		if err = c.sendResource(tlsConn); err != nil {
+			tlsConn.Close()
+			return
+		}
+	default:
+		tlsConn.Close()
 		return errors.New("unsupported protocol")
 	}
 
@@ -307,6 +433,22 @@ func (c *TlsClient) connect(ctx context.Context) (err error) {
 	return
 }
 
+// Sends the resource frame, which the server won't acknowledge.
+func (c *TlsClient) sendResource(conn *tls.Conn) (err error) {
+	var (
+		buf [logger.MaxResourceSize]byte
+		r   logger.Resource
+	)
+
+	if res := c.resource.Load(); res != nil {
+		r = *res
+	}
+
+	size := r.Encode(buf[:])
+	_, err = conn.Write(buf[:size])
+	return
+}
+
 func (c *TlsClient) disconnect() (err error) {
 	conn := c.conn.Swap(nil)
 
@@ -2,6 +2,7 @@ package peer
 
 import (
 	"context"
+	"crypto/ed25519"
 	"crypto/tls"
 	"crypto/x509"
 	"errors"
@@ -23,16 +24,20 @@ type TlsServer struct {
 }
 
 type TlsServerOptions struct {
-	Address       string
-	PrivateKey    auth.PrivateKey
-	Certificate   auth.Certificate
-	RootCa        auth.Certificate
-	EntryProc     logger.EntryProcessor
-	ClientTimeout time.Duration
-	Auth          func(ctx context.Context, x509Cert *x509.Certificate) (err error)
-	Clock         fastime.Fastime
-	Log           *logger.Logger
-	NoCopy        bool
+	Address           string
+	PrivateKey        auth.PrivateKey
+	Certificate       auth.Certificate
+	RootCa            auth.Certificate
+	EntryProc         logger.EntryProcessor
+	ClientTimeout     time.Duration
+	Auth              func(ctx context.Context, x509Cert *x509.Certificate) (err error)
+	Clock             fastime.Fastime
+	Log               *logger.Logger
+	NoCopy            bool
+	VerifySignatures  bool // Verify signed entries against the client certificate.
+	RequireSignatures bool // Reject unsigned entries and attachments (which are never signed). Implies `VerifySignatures`.
+	MaxAttachmentSize int  // Max size of each attachment. Default: logger.DefaultMaxAttachmentSize (1 MiB)
+	StrictDecode      bool // Reject entries with out-of-range values or invalid UTF-8.
 }
 
 func (opt *TlsServerOptions) setDefaults(ctx context.Context) {
@@ -44,6 +49,10 @@ func (opt *TlsServerOptions) setDefaults(ctx context.Context) {
 		opt.ClientTimeout = time.Minute
 	}
 
+	if opt.MaxAttachmentSize <= 0 {
+		opt.MaxAttachmentSize = logger.DefaultMaxAttachmentSize
+	}
+
 	if opt.Clock == nil {
 		opt.Clock = fastime.New().StartTimerD(ctx, time.Second)
 	}
@@ -81,7 +90,7 @@ func NewTlsServer(ctx context.Context, opt TlsServerOptions) (s *TlsServer, err
 		Time:         s.opt.Clock.Now,
 		MinVersion:   tls.VersionTLS13,
 		MaxVersion:   tls.VersionTLS13,
-		NextProtos:   []string{protoV11Ack, protoV10},
+		NextProtos:   []string{protoV12Ack, protoV11Ack, protoV10},
 		ClientAuth:   tls.RequireAndVerifyClientCert,
 		ClientCAs:    opt.RootCa.X509Pool(),
 		Certificates: opt.Certificate.TLSChain(opt.PrivateKey),
@@ -212,7 +221,12 @@ func (s *TlsServer) acquireConn(tlsConn *tls.Conn, log *logger.Logger) (conn *tl
 			entry:         new(logger.Entry),
 			clientTimeout: s.opt.ClientTimeout,
 			noCopy:        s.opt.NoCopy,
+			strict:        s.opt.StrictDecode,
+			verifySig:     s.opt.VerifySignatures || s.opt.RequireSignatures,
+			requireSig:    s.opt.RequireSignatures,
 		}
+
+		conn.attachments.maxSize = s.opt.MaxAttachmentSize
 	}
 
 	cert := state.PeerCertificates[0]
@@ -221,8 +235,12 @@ func (s *TlsServer) acquireConn(tlsConn *tls.Conn, log *logger.Logger) (conn *tl
 	cert.SerialNumber.FillBytes(certId[:])
 
 	conn.validBucketIds = cert.SubjectKeyId
+	// Left nil for other key types, which fails verification of signed entries
+	conn.publicKey, _ = cert.PublicKey.(ed25519.PublicKey)
 	conn.conn = tlsConn
-	conn.ack = state.NegotiatedProtocol == protoV11Ack
+	conn.ack = state.NegotiatedProtocol == protoV11Ack || state.NegotiatedProtocol == protoV12Ack
+	conn.identified = state.NegotiatedProtocol == protoV12Ack
+	conn.legacy = state.NegotiatedProtocol != protoV12Ack
 	conn.log = log.Tag(certId)
 	conn.timeConnected = s.opt.Clock.UnixNow()
 	conn.timeLastActive = conn.timeConnected
@@ -234,10 +252,13 @@ func (s *TlsServer) releaseConn(conn *tlsServerConn) {
 	conn.conn.Close()
 	conn.conn = nil
 	conn.validBucketIds = nil
+	conn.publicKey = nil
 	conn.log = nil
 	conn.pingsReceived = 0
 	conn.pongsSent = 0
 	conn.entriesReceived = 0
 	conn.entriesSucceeded = 0
+	conn.resource = nil
+	conn.attachments.reset()
 	s.connPool.Put(conn)
 }
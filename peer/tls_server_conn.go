@@ -3,6 +3,7 @@ package peer
 import (
 	"bytes"
 	"context"
+	"crypto/ed25519"
 	"crypto/tls"
 	"encoding/binary"
 	"errors"
@@ -19,11 +20,15 @@ var errPonged = errors.New("ponged")
 type tlsServerConn struct {
 	buf              [logger.MaxEntrySize]byte
 	validBucketIds   []byte
+	publicKey        ed25519.PublicKey
 	entryProc        logger.EntryProcessor
 	clock            fastime.Fastime
 	entry            *logger.Entry
+	chunk            logger.AttachmentChunk
+	attachments      attachmentAssembler
 	conn             *tls.Conn
 	log              *logger.Logger
+	resource         *logger.Resource
 	clientTimeout    time.Duration
 	timeConnected    int64
 	timeLastActive   int64
@@ -32,10 +37,21 @@ type tlsServerConn struct {
 	entriesReceived  int32
 	entriesSucceeded int32
 	noCopy           bool
+	strict           bool
 	ack              bool
+	identified       bool
+	legacy           bool // Clients before v1.2-ack send entries in the legacy layout
+	verifySig        bool
+	requireSig       bool
 }
 
 func (conn *tlsServerConn) listen(ctx context.Context) (err error) {
+	if conn.identified {
+		if err = conn.readResource(); err != nil {
+			return
+		}
+	}
+
 	for {
 		if err = conn.handleEntry(ctx); err != nil {
 			if conn.ack {
@@ -92,10 +108,46 @@ func (conn *tlsServerConn) handleEntry(ctx context.Context) (err error) {
 		return logger.ErrForbiddenBucket
 	}
 
-	if err = conn.entry.Decode(conn.buf[:size], conn.noCopy); err != nil {
+	// Attachments are unsigned, and kept until the entry they belong to arrives. They aren't
+	// covered by the signature of their entry, so they're refused when signatures are required.
+	if logger.IsAttachmentChunk(conn.buf[:size]) {
+		if conn.requireSig {
+			return logger.ErrUnsignedAttachment
+		}
+
+		if err = conn.chunk.Decode(conn.buf[:size]); err != nil {
+			return
+		}
+
+		conn.attachments.add(&conn.chunk)
+		return
+	}
+
+	if conn.verifySig {
+		if err = logger.VerifySignature(conn.buf[:size], conn.publicKey); err == logger.ErrMissingSignature && !conn.requireSig {
+			err = nil
+		} else if err != nil {
+			return
+		}
+	}
+
+	if conn.legacy && conn.strict {
+		err = conn.entry.DecodeLegacyStrict(conn.buf[:size], conn.noCopy)
+	} else if conn.legacy {
+		err = conn.entry.DecodeLegacy(conn.buf[:size], conn.noCopy)
+	} else if conn.strict {
+		err = conn.entry.DecodeStrict(conn.buf[:size], conn.noCopy)
+	} else {
+		err = conn.entry.Decode(conn.buf[:size], conn.noCopy)
+	}
+
+	if err != nil {
 		return
 	}
 
+	conn.entry.Resource(conn.resource)
+	conn.attachments.attachTo(conn.entry)
+
 	if err = conn.entryProc.ProcessEntry(ctx, conn.entry); err != nil {
 		err = conn.log.Err("Failed to process entry %s", conn.entry.Read().Id()).MetaBlob(err.Error())
 	} else {
@@ -105,6 +157,29 @@ func (conn *tlsServerConn) handleEntry(ctx context.Context) (err error) {
 	return
 }
 
+// Reads the resource frame that identifies the client. A new resource is allocated per
+// connection, as entries might reference it after the connection is closed.
+func (conn *tlsServerConn) readResource() (err error) {
+	conn.conn.SetReadDeadline(conn.clock.Now().Add(conn.clientTimeout))
+
+	if _, err = io.ReadFull(conn.conn, conn.buf[:2]); err != nil {
+		return
+	}
+
+	size := binary.BigEndian.Uint16(conn.buf[:2])
+
+	if size < 6 || size > logger.MaxResourceSize {
+		return logger.ErrCorruptEntry
+	}
+
+	if _, err = io.ReadFull(conn.conn, conn.buf[2:size]); err != nil {
+		return
+	}
+
+	conn.resource = new(logger.Resource)
+	return conn.resource.Decode(conn.buf[:size])
+}
+
 func (conn *tlsServerConn) sendAck(ack respType) (err error) {
 	_, err = conn.conn.Write([]byte{byte(ack)})
 
@@ -0,0 +1,455 @@
+package peer
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rs/xid"
+	"github.com/webbmaffian/go-logger"
+	"github.com/webbmaffian/go-logger/auth"
+)
+
+type testCerts struct {
+	rootKey    auth.PrivateKey
+	rootCa     auth.Certificate
+	serverKey  auth.PrivateKey
+	serverCert auth.Certificate
+	clientKey  auth.PrivateKey
+	clientCert auth.Certificate
+}
+
+func newTestCerts(t *testing.T) (c testCerts) {
+	t.Helper()
+	var err error
+
+	if c.rootKey, err = auth.CreatePrivateKey(); err != nil {
+		t.Fatal(err)
+	}
+
+	if c.rootCa, err = auth.CreateCertificate(c.rootKey, nil, auth.CertificateOptions{
+		PublicKey: c.rootKey.Public(),
+		Type:      auth.Root,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if c.serverKey, err = auth.CreatePrivateKey(); err != nil {
+		t.Fatal(err)
+	}
+
+	if c.serverCert, err = auth.CreateCertificate(c.rootKey, c.rootCa, auth.CertificateOptions{
+		PublicKey:   c.serverKey.Public(),
+		IPAddresses: []net.IP{net.IPv4(127, 0, 0, 1)},
+		Type:        auth.Server,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if c.clientKey, err = auth.CreatePrivateKey(); err != nil {
+		t.Fatal(err)
+	}
+
+	if c.clientCert, err = auth.CreateCertificate(c.rootKey, c.rootCa, auth.CertificateOptions{
+		BucketIds: []uint32{123},
+		PublicKey: c.clientKey.Public(),
+		Type:      auth.Client,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	return
+}
+
+// Records what the server received. Entries are reused by the server, so only copies are kept.
+type receivedEntries struct {
+	mu          sync.Mutex
+	messages    []string
+	attachments []map[string]int
+	resources   []*logger.Resource
+}
+
+func (r *receivedEntries) ProcessEntry(_ context.Context, e *logger.Entry) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	keys, values := e.Read().Attachments()
+	att := make(map[string]int, len(keys))
+
+	for i := range keys {
+		att[keys[i]] = len(values[i])
+	}
+
+	r.messages = append(r.messages, e.String())
+	r.attachments = append(r.attachments, att)
+	r.resources = append(r.resources, e.Read().Resource())
+	return nil
+}
+
+func (r *receivedEntries) count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.messages)
+}
+
+// Starts a server on a random port, and returns its address. Any options are applied before
+// the server is started.
+func startTestServer(t *testing.T, certs testCerts, proc logger.EntryProcessor, options ...func(opt *TlsServerOptions)) string {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	opt := TlsServerOptions{
+		Address:     "127.0.0.1:0",
+		PrivateKey:  certs.serverKey,
+		Certificate: certs.serverCert,
+		RootCa:      certs.rootCa,
+		EntryProc:   proc,
+	}
+
+	for _, o := range options {
+		o(&opt)
+	}
+
+	s, err := NewTlsServer(ctx, opt)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return s.listener.Addr().String()
+}
+
+func newTestClient(t *testing.T, certs testCerts, addr string) *TlsClient {
+	t.Helper()
+
+	cli, err := NewTlsClient(TlsClientOptions{
+		Address:     addr,
+		PrivateKey:  certs.clientKey,
+		Certificate: certs.clientCert,
+		RootCa:      certs.rootCa,
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { cli.ForceClose() })
+	return cli
+}
+
+// Connects to a server with the v1.1-ack protocol, to send raw frames.
+func dialTestServer(t *testing.T, certs testCerts, addr string) *tls.Conn {
+	t.Helper()
+
+	conn, err := tls.Dial("tcp", addr, &tls.Config{
+		Certificates: []tls.Certificate{*certs.clientCert.TLS(certs.clientKey)},
+		RootCAs:      certs.rootCa.X509Pool(),
+		MinVersion:   tls.VersionTLS13,
+		NextProtos:   []string{protoV11Ack},
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { conn.Close() })
+
+	if proto := conn.ConnectionState().NegotiatedProtocol; proto != protoV11Ack {
+		t.Fatalf("expected %s, got %s", protoV11Ack, proto)
+	}
+
+	return conn
+}
+
+func waitForEntries(t *testing.T, rec *receivedEntries, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+
+	for rec.count() < n {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %d entries, got %d", n, rec.count())
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestServerAttachments(t *testing.T) {
+	var rec receivedEntries
+	certs := newTestCerts(t)
+	cli := newTestClient(t, certs, startTestServer(t, certs, &rec))
+	pool, err := logger.NewPool(cli, logger.PoolOptions{BucketId: 123})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	log := pool.Logger()
+	large := strings.Repeat("x", 200000)
+
+	for i := 0; i < 2; i++ {
+		log.Info("upload %d", i).Attach("request", large).Attach("resp", "hello").Send()
+	}
+
+	waitForEntries(t, &rec, 2)
+
+	for i, att := range rec.attachments {
+		if len(att) != 2 || att["request"] != len(large) || att["resp"] != 5 {
+			t.Errorf("entry %d: unexpected attachments %v", i, att)
+		}
+	}
+}
+
+func TestServerAttachmentsConcurrent(t *testing.T) {
+	var (
+		rec receivedEntries
+		wg  sync.WaitGroup
+	)
+
+	certs := newTestCerts(t)
+	cli, err := NewTlsClient(TlsClientOptions{
+		Address:     startTestServer(t, certs, &rec),
+		PrivateKey:  certs.clientKey,
+		Certificate: certs.clientCert,
+		RootCa:      certs.rootCa,
+		WriteMethod: WriteOrBlock,
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { cli.ForceClose() })
+	pool, err := logger.NewPool(cli, logger.PoolOptions{BucketId: 123})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	large := strings.Repeat("x", 150000)
+
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+
+		go func(i int) {
+			defer wg.Done()
+			log := pool.Logger()
+			defer log.Drop()
+
+			for j := 0; j < 4; j++ {
+				log.Info("upload %d", i).Attach("request", large).Send()
+			}
+		}(i)
+	}
+
+	wg.Wait()
+	waitForEntries(t, &rec, 64)
+
+	for i, att := range rec.attachments {
+		if att["request"] != len(large) {
+			t.Errorf("entry %d: unexpected attachments %v", i, att)
+		}
+	}
+}
+
+func TestAttachmentAssemblerDuplicateChunks(t *testing.T) {
+	var (
+		buf   [logger.MaxEntrySize]byte
+		e     logger.Entry
+		chunk logger.AttachmentChunk
+		a     = attachmentAssembler{maxSize: logger.DefaultMaxAttachmentSize}
+	)
+
+	e.Reset()
+	e.Id(xid.New()).Msg("upload").Attach("body", strings.Repeat("x", 100000))
+
+	// Send each chunk twice
+	for offset := 0; offset < 100000; {
+		size, next := e.EncodeAttachment(buf[:], 0, offset)
+
+		for i := 0; i < 2; i++ {
+			if err := chunk.Decode(buf[:size]); err != nil {
+				t.Fatal(err)
+			}
+
+			a.add(&chunk)
+		}
+
+		offset = next
+	}
+
+	var d logger.Entry
+	d.Reset()
+	d.Id(e.Read().Id())
+	a.attachTo(&d)
+
+	if _, values := d.Read().Attachments(); len(values) != 1 || len(values[0]) != 100000 {
+		t.Errorf("expected one complete attachment, got %d", len(values))
+	}
+}
+
+func TestServerHandshake(t *testing.T) {
+	var rec receivedEntries
+	certs := newTestCerts(t)
+	addr := startTestServer(t, certs, &rec)
+
+	// v1.2-ack: the client identifies itself before sending entries
+	cli := newTestClient(t, certs, addr)
+	pool, err := logger.NewPool(cli, logger.PoolOptions{BucketId: 123, Resource: logger.Resource{Service: "billing"}})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pool.Logger().Info("identified").Send()
+	waitForEntries(t, &rec, 1)
+
+	if r := rec.resources[0]; r == nil || r.Service != "billing" || r.Pid == 0 {
+		t.Errorf("expected resource, got %+v", r)
+	}
+
+	// v1.1-ack: older clients send entries in the legacy layout right away, without a resource
+	conn := dialTestServer(t, certs, addr)
+
+	var (
+		buf [logger.MaxEntrySize]byte
+		e   logger.Entry
+	)
+
+	e.Reset()
+	size := e.Bucket(123).Id(xid.New()).Msg("anonymous").Metric("n", 5).ManualTrace("main.go", 12).EncodeLegacy(buf[:])
+
+	if _, err = conn.Write(buf[:size]); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = io.ReadFull(conn, buf[:1]); err != nil || respType(buf[0]) != respAckOK {
+		t.Fatalf("expected ack, got %d: %v", buf[0], err)
+	}
+
+	waitForEntries(t, &rec, 2)
+
+	if rec.messages[1] != "anonymous" || rec.resources[1] != nil {
+		t.Errorf("unexpected entry %q with resource %+v", rec.messages[1], rec.resources[1])
+	}
+}
+
+func TestServerRequireSignaturesAttachments(t *testing.T) {
+	var (
+		rec receivedEntries
+		buf [logger.MaxEntrySize]byte
+		e   logger.Entry
+	)
+
+	certs := newTestCerts(t)
+	conn := dialTestServer(t, certs, startTestServer(t, certs, &rec, func(opt *TlsServerOptions) {
+		opt.RequireSignatures = true
+	}))
+
+	// Attachments aren't covered by the signature of their entry, so they can't be trusted
+	e.Reset()
+	e.Bucket(123).Id(xid.New()).Msg("signed").Attach("body", "forged")
+	size, _ := e.EncodeAttachment(buf[:], 0, 0)
+
+	if _, err := conn.Write(buf[:size]); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := io.ReadFull(conn, buf[:1]); err != nil || respType(buf[0]) != respAckNOK {
+		t.Fatalf("expected chunk to be refused, got %d: %v", buf[0], err)
+	}
+}
+
+// Servers before v1.2-ack get entries in the legacy layout, without attachments.
+func TestClientLegacyServer(t *testing.T) {
+	certs := newTestCerts(t)
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{*certs.serverCert.TLS(certs.serverKey)},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    certs.rootCa.X509Pool(),
+		MinVersion:   tls.VersionTLS13,
+		NextProtos:   []string{protoV11Ack, protoV10},
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { listener.Close() })
+	received := make(chan logger.Entry, 4)
+
+	go func() {
+		conn, err := listener.Accept()
+
+		if err != nil {
+			return
+		}
+
+		defer conn.Close()
+		var buf [logger.MaxEntrySize]byte
+
+		for {
+			if _, err := io.ReadFull(conn, buf[:2]); err != nil {
+				return
+			}
+
+			size := int(buf[0])<<8 | int(buf[1])
+
+			if _, err := io.ReadFull(conn, buf[2:size]); err != nil {
+				return
+			}
+
+			var e logger.Entry
+			ack := respAckOK
+
+			if err := e.DecodeLegacyStrict(buf[:size]); err != nil {
+				ack = respAckNOK
+			}
+
+			received <- e
+			conn.Write([]byte{byte(ack)})
+		}
+	}()
+
+	cli := newTestClient(t, certs, listener.Addr().String())
+	pool, err := logger.NewPool(cli, logger.PoolOptions{BucketId: 123})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	log := pool.Logger()
+	log.Info("attached").Attach("body", strings.Repeat("x", 100000)).MetricFloat("ratio", 0.5).Send()
+	log.Info("traced").Trace().Send()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// Skipped attachment chunks must be acknowledged along with their entry
+	if err = cli.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, msg := range []string{"attached", "traced"} {
+		select {
+		case e := <-received:
+			if e.Read().Msg() != msg {
+				t.Errorf("expected %q, got %q", msg, e.Read().Msg())
+			}
+		default:
+			t.Fatalf("expected %q to be received", msg)
+		}
+	}
+
+	select {
+	case e := <-received:
+		t.Errorf("unexpected frame: %s", e.String())
+	default:
+	}
+}
@@ -2,15 +2,29 @@ package logger
 
 import (
 	"context"
+	"os"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/rs/xid"
 )
 
+// Called after a fatal entry has been sent, by pools without `PoolOptions.ExitFunc` and by
+// entries without a pool. Replace it before creating any pools, e.g. in tests.
+var DefaultExitFunc = os.Exit
+
 type Pool struct {
-	loggerPool sync.Pool
-	client     Client
-	opt        PoolOptions
+	loggerPool  sync.Pool
+	closed      atomic.Bool
+	minSeverity atomic.Int32
+	client      Client
+	samplers    []SamplerDrainer // Drained on flush, see `Pool.Flush`
+	dedups      []*Deduplicator  // Flushed on flush, see `Pool.Flush`
+	flushMu     sync.Mutex
+	logger      *Logger // Shared by `Pool.Send` and the no-op entry
+	noop        *Entry  // Returned for filtered entries. All its methods are no-ops, so that it can be shared.
+	opt         PoolOptions
 }
 
 type PoolOptions struct {
@@ -19,6 +33,22 @@ type PoolOptions struct {
 	DefaultEntryTTL    uint16
 	DefaultMetaTTL     uint16
 	StackTraceSeverity Severity
+	MinSeverity        Severity       // Entries of less severity are filtered. Adjustable with `Pool.SetMinSeverity`. Default: DEBUG
+	LevelRules         *LevelRules    // Rules overriding the min severity of matching entries, can be shared between pools. Default: an empty registry
+	Sampler            Sampler        // Decides which entries are sent, e.g. `NewTokenBucketSampler`. Adjustable per logger with `Logger.Sampler`. Default: none (all are sent)
+	Clock              Clock          // Clock used for timestamping entries. Default: the client
+	TimePrecision      time.Duration  // Precision of timestamps, but never finer than the clock's (e.g. `TlsClientOptions.ClockPrecision`), so the coarser of the two wins. Default: time.Second (no sub-second part)
+	TraceExtractor     TraceExtractor // Extracts trace context in `Logger.Ctx`. Default: TraceFromContext
+	TrimStackTrace     bool           // Replace directories in stack traces with package paths, and strip package paths from function names
+	NoStackTrace       bool           // Disable automatic stack traces and callers
+	TraceCaller        bool           // Record only the caller's frame of entries below `StackTraceSeverity`
+	Resource           Resource       // Identity of the process, sent by clients implementing `ClientIdentifier`
+	Checksum           bool           // Append a CRC32C checksum to every encoded entry
+	Fingerprint        bool           // Append the fingerprint (see `Entry.Fingerprint`) to every encoded entry
+	MaxAttachmentSize  int            // Max size of each attachment. Default: DefaultMaxAttachmentSize (1 MiB)
+	TruncationMarker   string         // Appended to truncated strings, e.g. "…". Default: none
+	FlushTimeout       time.Duration  // Max time to wait for the client to flush after a panic or fatal entry. Default: 5 seconds
+	ExitFunc           func(code int) // Called after a fatal entry has been sent. Default: DefaultExitFunc
 }
 
 func (opt *PoolOptions) setDefaults() {
@@ -36,9 +66,40 @@ func (opt *PoolOptions) setDefaults() {
 		opt.StackTraceSeverity = NOTICE
 	}
 
+	// Same here
+	if opt.MinSeverity == 0 {
+		opt.MinSeverity = DEBUG
+	}
+
 	if opt.EntryPool == nil {
 		opt.EntryPool = new(EntryPool)
 	}
+
+	if opt.LevelRules == nil {
+		opt.LevelRules = new(LevelRules)
+	}
+
+	if opt.TimePrecision <= 0 {
+		opt.TimePrecision = time.Second
+	}
+
+	if opt.TraceExtractor == nil {
+		opt.TraceExtractor = TraceFromContext
+	}
+
+	if opt.MaxAttachmentSize <= 0 {
+		opt.MaxAttachmentSize = DefaultMaxAttachmentSize
+	}
+
+	if opt.FlushTimeout <= 0 {
+		opt.FlushTimeout = time.Second * 5
+	}
+
+	if opt.ExitFunc == nil {
+		opt.ExitFunc = DefaultExitFunc
+	}
+
+	opt.Resource.setDefaults()
 }
 
 func NewPool(client Client, options ...PoolOptions) (*Pool, error) {
@@ -50,10 +111,25 @@ func NewPool(client Client, options ...PoolOptions) (*Pool, error) {
 
 	opt.setDefaults()
 
-	return &Pool{
+	if opt.Clock == nil {
+		opt.Clock = client
+	}
+
+	if cli, ok := client.(ClientIdentifier); ok {
+		cli.Identify(opt.Resource)
+	}
+
+	pool := &Pool{
 		client: client,
 		opt:    opt,
-	}, nil
+	}
+
+	pool.minSeverity.Store(int32(opt.MinSeverity))
+	pool.registerSampler(opt.Sampler)
+	pool.logger = pool.Logger()
+	pool.noop = &Entry{noop: true, level: _3_Message, logger: pool.logger}
+
+	return pool, nil
 }
 
 func (pool *Pool) Logger() *Logger {
@@ -61,11 +137,41 @@ func (pool *Pool) Logger() *Logger {
 		return l.(*Logger)
 	}
 
-	return &Logger{
-		pool:     pool,
-		ttlEntry: pool.opt.DefaultEntryTTL,
-		ttlMeta:  pool.opt.DefaultMetaTTL,
+	l := &Logger{
+		pool:          pool,
+		ttlEntry:      pool.opt.DefaultEntryTTL,
+		ttlMeta:       pool.opt.DefaultMetaTTL,
+		traceSeverity: pool.opt.StackTraceSeverity,
+		noTrace:       pool.opt.NoStackTrace,
+		traceCaller:   pool.opt.TraceCaller,
+		sampler:       pool.opt.Sampler,
 	}
+
+	l.minSeverity.Store(inheritSeverity)
+
+	return l
+}
+
+// Sets the severity at or above which entries are sent, for all loggers that haven't set their
+// own. Safe to call at any time, e.g. to temporarily enable DEBUG.
+func (pool *Pool) SetMinSeverity(severity Severity) {
+	pool.minSeverity.Store(int32(severity))
+}
+
+// Returns the severity at or above which entries are sent.
+func (pool *Pool) MinSeverity() Severity {
+	return Severity(pool.minSeverity.Load())
+}
+
+// Returns the rules overriding the min severity of matching entries.
+func (pool *Pool) LevelRules() *LevelRules {
+	return pool.opt.LevelRules
+}
+
+// Returns whether entries of the severity are sent, unless a logger has set its own threshold
+// or a level rule matches.
+func (pool *Pool) Enabled(severity Severity) bool {
+	return int32(severity) <= pool.minSeverity.Load()
 }
 
 func (pool *Pool) ReleaseLogger(l *Logger) {
@@ -82,28 +188,158 @@ func (pool *Pool) ReleaseEntry(e *Entry) {
 	pool.opt.EntryPool.Release(e)
 }
 
+// Send an error to the log, with any causes in its chain recorded as meta. See `ErrorDecorator`
+// for how errors can decorate the entry.
 func (pool *Pool) Send(err error) (id xid.ID) {
-	var (
-		e  *Entry
-		ok bool
-	)
-
-	if e, ok = err.(*Entry); ok {
+	if e, ok := err.(*Entry); ok {
 		return e.Send()
 	}
 
-	e = pool.Entry()
-	e.severity = ERR
-	parseErrorString(e, err.Error())
-	id = e.id
-	pool.client.ProcessEntry(context.Background(), e)
-	return
+	return pool.logger.logError().captureError(err).Send()
+}
+
+// Wait until all entries have been sent by the client, if it buffers entries (see `ClientFlusher`).
+// Any duplicates collapsed by deduplicators, and entries suppressed by samplers that haven't been
+// reported yet, are sent first.
+func (pool *Pool) Flush(ctx context.Context) error {
+	pool.flushPending()
+
+	if cli, ok := pool.client.(ClientFlusher); ok {
+		return cli.Flush(ctx)
+	}
+
+	return nil
 }
 
+// Flushes the client, waiting at most `PoolOptions.FlushTimeout`.
+func (pool *Pool) flush() error {
+	ctx, cancel := context.WithTimeout(context.Background(), pool.opt.FlushTimeout)
+	defer cancel()
+	return pool.Flush(ctx)
+}
+
+// Stops accepting entries, and gracefully closes the client if it implements `ClientCloser`.
+// Returns `ErrClosed` if already closed.
 func (pool *Pool) CloseClient(ctx context.Context) error {
+	if pool.closed.Load() {
+		return ErrClosed
+	}
+
+	pool.flushPending()
+
+	if !pool.closed.CompareAndSwap(false, true) {
+		return ErrClosed
+	}
+
 	if cli, ok := pool.client.(ClientCloser); ok {
 		return cli.Close(ctx)
 	}
 
 	return nil
 }
+
+// Registers a sampler to be drained on flush, unless already registered.
+func (pool *Pool) registerSampler(s Sampler) {
+	d, ok := s.(SamplerDrainer)
+
+	if !ok {
+		return
+	}
+
+	pool.flushMu.Lock()
+	defer pool.flushMu.Unlock()
+
+	for _, registered := range pool.samplers {
+		if registered == d {
+			return
+		}
+	}
+
+	pool.samplers = append(pool.samplers, d)
+}
+
+// Registers a deduplicator to be flushed on flush, unless already registered.
+func (pool *Pool) registerDedup(d *Deduplicator) {
+	if d == nil {
+		return
+	}
+
+	pool.flushMu.Lock()
+	defer pool.flushMu.Unlock()
+
+	for _, registered := range pool.dedups {
+		if registered == d {
+			return
+		}
+	}
+
+	pool.dedups = append(pool.dedups, d)
+}
+
+// Stops draining the sampler on flush, once no logger of the pool uses it anymore. Any entries
+// it suppressed that haven't been reported yet are reported first.
+func (pool *Pool) ReleaseSampler(s Sampler) {
+	d, ok := s.(SamplerDrainer)
+
+	if !ok {
+		return
+	}
+
+	pool.flushMu.Lock()
+	samplers := make([]SamplerDrainer, 0, len(pool.samplers))
+
+	// A new slice is needed, as any ongoing flush iterates the current one
+	for _, registered := range pool.samplers {
+		if registered != d {
+			samplers = append(samplers, registered)
+		}
+	}
+
+	pool.samplers = samplers
+	pool.flushMu.Unlock()
+
+	for _, suppressed := range d.Drain() {
+		pool.logger.sendSuppressed(suppressed.Severity, suppressed.Message, suppressed.Count)
+	}
+}
+
+// Stops flushing the deduplicator on flush, once no logger of the pool uses it anymore. Any
+// collapsed duplicates are sent first.
+func (pool *Pool) ReleaseDedup(d *Deduplicator) {
+	if d == nil {
+		return
+	}
+
+	pool.flushMu.Lock()
+	dedups := make([]*Deduplicator, 0, len(pool.dedups))
+
+	// A new slice is needed, as any ongoing flush iterates the current one
+	for _, registered := range pool.dedups {
+		if registered != d {
+			dedups = append(dedups, registered)
+		}
+	}
+
+	pool.dedups = dedups
+	pool.flushMu.Unlock()
+
+	d.Flush()
+}
+
+// Sends all duplicates collapsed by registered deduplicators, and reports all entries suppressed
+// by registered samplers that haven't been reported yet.
+func (pool *Pool) flushPending() {
+	pool.flushMu.Lock()
+	samplers, dedups := pool.samplers, pool.dedups
+	pool.flushMu.Unlock()
+
+	for _, d := range dedups {
+		d.Flush()
+	}
+
+	for _, s := range samplers {
+		for _, suppressed := range s.Drain() {
+			pool.logger.sendSuppressed(suppressed.Severity, suppressed.Message, suppressed.Count)
+		}
+	}
+}
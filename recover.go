@@ -0,0 +1,81 @@
+package logger
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+)
+
+// Recovers from a panic and sends it as an entry with the stack trace of the panic, and waits for
+// the client to flush (at most `PoolOptions.FlushTimeout`). Must be deferred directly, e.g.
+// `defer log.Recover()`. Optionally re-panic with the same value once flushed, in which case
+// the entry is EMERG instead of CRIT.
+func (l *Logger) Recover(repanic ...bool) {
+	if r := recover(); r != nil {
+		l.sendPanic(r, repanic != nil && repanic[0])
+	}
+}
+
+// Runs the function in a new goroutine, where any panic is recovered and sent as a CRIT entry
+// instead of crashing the process.
+func (l *Logger) Go(fn func()) {
+	go func() {
+		defer l.Recover()
+		fn()
+	}()
+}
+
+func (l *Logger) sendPanic(r any, repanic bool) {
+	severity := CRIT
+
+	if repanic {
+		severity = EMERG
+	}
+
+	e := l.entry(severity, "Panic: %s").Tag(fmt.Sprint(r))
+
+	if err, ok := r.(error); ok {
+		e.Wrap(err)
+	}
+
+	e.addPanicTrace()
+	e.Send()
+	l.pool.flush()
+
+	if repanic {
+		panic(r)
+	}
+}
+
+// Records the stack trace of a panic, starting at the function that panicked. Must be called
+// from a deferred function while panicking.
+func (e *Entry) addPanicTrace() {
+	var trace [64]uintptr
+	n := runtime.Callers(2, trace[:])
+	frames := runtime.CallersFrames(trace[:n])
+	trim := e.logger != nil && e.logger.pool.opt.TrimStackTrace
+	panicking := false
+
+	for {
+		frame, more := frames.Next()
+
+		// Skip everything up until the panic, and any runtime frames leading to it (e.g. of
+		// a nil pointer dereference)
+		if !panicking {
+			panicking = frame.Function == "runtime.gopanic"
+		} else if e.stackTraceCount > 0 || !strings.HasPrefix(frame.Function, "runtime.") {
+			// Capped like automatic stack traces, so frames beyond the max aren't reported as dropped
+			if e.stackTraceCount >= MaxStackTraceCount {
+				break
+			}
+
+			e.incLevel(_8_Stack_trace)
+			e.setStackFrame(e.stackTraceCount, frame.File, frame.Function, frame.Line, trim)
+			e.stackTraceCount++
+		}
+
+		if !more {
+			break
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package logger
+
+import (
+	"encoding/binary"
+	"math"
+	"os"
+	"runtime/debug"
+)
+
+/*
+	Resource
+		2 bytes (uint16) size annotation
+		4 bytes (uint32) process ID
+		Followed by hostname, service, version, Go version, module and revision:
+			1 byte (uint8) length (X)
+			X bytes string
+*/
+
+const (
+	MaxResourceSize      = 2 + 4 + 6*(1+MaxResourceFieldSize)
+	MaxResourceFieldSize = math.MaxUint8
+)
+
+// Identity of the process emitting entries. A resource is sent once per connection rather than
+// with every entry, and attached to all entries decoded from the connection.
+type Resource struct {
+	Hostname  string // Default: os.Hostname()
+	Service   string
+	Version   string // Default: version of the main module
+	GoVersion string // Default: Go version the binary was built with
+	Module    string // Default: path of the main module
+	Revision  string // Default: VCS revision the binary was built from
+	Pid       uint32 // Default: os.Getpid()
+}
+
+// Fills any empty fields with information about the running process.
+func (r *Resource) setDefaults() {
+	if r.Hostname == "" {
+		r.Hostname, _ = os.Hostname()
+	}
+
+	if r.Pid == 0 {
+		r.Pid = uint32(os.Getpid())
+	}
+
+	info, ok := debug.ReadBuildInfo()
+
+	if !ok {
+		return
+	}
+
+	if r.GoVersion == "" {
+		r.GoVersion = info.GoVersion
+	}
+
+	if r.Module == "" {
+		r.Module = info.Main.Path
+	}
+
+	if r.Version == "" && info.Main.Version != "(devel)" {
+		r.Version = info.Main.Version
+	}
+
+	if r.Revision == "" {
+		for _, setting := range info.Settings {
+			if setting.Key == "vcs.revision" {
+				r.Revision = setting.Value
+				break
+			}
+		}
+	}
+}
+
+// Encodes the resource to a binary representation into b. If b isn't large enough
+// (`MaxResourceSize`) we will panic. Returns number of bytes written.
+func (r *Resource) Encode(b []byte) (s int) {
+	// Reserve two bytes for the size annotation
+	s += 2
+
+	binary.BigEndian.PutUint32(b[s:], r.Pid)
+	s += 4
+
+	for _, str := range [...]string{r.Hostname, r.Service, r.Version, r.GoVersion, r.Module, r.Revision} {
+		str = truncate(str, MaxResourceFieldSize)
+		b[s] = uint8(len(str))
+		s++
+		s += copy(b[s:], str)
+	}
+
+	binary.BigEndian.PutUint16(b, uint16(s))
+
+	return
+}
+
+// Decodes a binary representation into the resource. Strings are always copied.
+func (r *Resource) Decode(b []byte) (err error) {
+	*r = Resource{}
+
+	if len(b) < 6 {
+		return ErrTooShort
+	}
+
+	total := int(binary.BigEndian.Uint16(b))
+
+	if len(b) != total {
+		return ErrCorruptEntry
+	}
+
+	r.Pid = binary.BigEndian.Uint32(b[2:])
+	s := 6
+
+	for _, str := range [...]*string{&r.Hostname, &r.Service, &r.Version, &r.GoVersion, &r.Module, &r.Revision} {
+		// Out of range?
+		if s >= total {
+			return ErrCorruptEntry
+		}
+
+		size := int(b[s])
+		s++
+
+		// Out of range?
+		if s+size > total {
+			return ErrCorruptEntry
+		}
+
+		*str = string(b[s : s+size])
+		s += size
+	}
+
+	if s != total {
+		return ErrCorruptEntry
+	}
+
+	return
+}
+
+// Implements encoding.BinaryMarshaler
+func (r Resource) MarshalBinary() ([]byte, error) {
+	var b [MaxResourceSize]byte
+	s := r.Encode(b[:])
+	return b[:s], nil
+}
+
+// Implements encoding.BinaryUnmarshaler
+func (r *Resource) UnmarshalBinary(b []byte) error {
+	return r.Decode(b)
+}
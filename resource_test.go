@@ -0,0 +1,57 @@
+package logger
+
+import (
+	"encoding/binary"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestResource(t *testing.T) {
+	var (
+		buf [MaxResourceSize]byte
+		d   Resource
+	)
+
+	r := Resource{
+		Hostname:  "web-1",
+		Service:   "billing",
+		Version:   "v1.2.3",
+		GoVersion: "go1.22.0",
+		Module:    "github.com/foo/billing",
+		Revision:  strings.Repeat("a", 300),
+		Pid:       4321,
+	}
+
+	size := r.Encode(buf[:])
+
+	if err := d.Decode(buf[:size]); err != nil {
+		t.Fatal(err)
+	}
+
+	r.Revision = r.Revision[:MaxResourceFieldSize]
+
+	if d != r {
+		t.Errorf("expected %+v, got %+v", r, d)
+	}
+
+	// Malformed input must be rejected, and never panic
+	tests := []struct {
+		name   string
+		b      []byte
+		expect error
+	}{
+		{"empty", nil, ErrTooShort},
+		{"short", buf[:5], ErrTooShort},
+		{"size mismatch", buf[:size-1], ErrCorruptEntry},
+		{"missing fields", append(binary.BigEndian.AppendUint16(nil, 7), 0, 0, 0, 1, 0), ErrCorruptEntry},
+		{"field out of range", append(binary.BigEndian.AppendUint16(nil, 8), 0, 0, 0, 1, 255, 'a'), ErrCorruptEntry},
+		{"trailing bytes", append(binary.BigEndian.AppendUint16(nil, 13), 0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 'x'), ErrCorruptEntry},
+	}
+
+	for _, test := range tests {
+		if err := d.Decode(test.b); !errors.Is(err, test.expect) {
+			t.Errorf("%s: expected %v, got %v", test.name, test.expect, err)
+		}
+	}
+}
@@ -0,0 +1,276 @@
+package logger
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Max number of message templates tracked by a sampler. When exceeded, all counts are reset, and
+// any suppressed counts are kept until drained.
+const MaxSamplerKeys = 4096
+
+// Decides whether entries are sent, e.g. to keep a hot error path from evicting everything else
+// from the client's buffer. Samplers are consulted by loggers before any entry is created.
+type Sampler interface {
+	// Returns whether an entry should be sent, and how many entries that were suppressed since
+	// the last one that was sent. Suppressed entries are reported in a summary entry.
+	Sample(severity Severity, message string, now time.Time) (ok bool, suppressed uint64)
+}
+
+// Implemented by samplers that can report suppressed entries that haven't been reported yet, e.g.
+// because no entry with the same template has been sent since. Drained samplers are reported in
+// summary entries when the pool is flushed or closed.
+type SamplerDrainer interface {
+	Sampler
+
+	// Returns and resets all suppressed counts that haven't been reported.
+	Drain() []Suppressed
+}
+
+// Number of entries suppressed by a sampler. The message is empty for samplers that don't
+// sample by message template.
+type Suppressed struct {
+	Message  string
+	Count    uint64
+	Severity Severity
+}
+
+var (
+	_ SamplerDrainer = (*TokenBucketSampler)(nil)
+	_ SamplerDrainer = (*FirstThenEverySampler)(nil)
+	_ SamplerDrainer = (*ProbabilitySampler)(nil)
+)
+
+// Limits entries per message template with token buckets.
+type TokenBucketSampler struct {
+	buckets map[string]*tokenBucket
+	pending []Suppressed // Counts of reset buckets
+	rate    float64
+	burst   float64
+	mu      sync.Mutex
+}
+
+type tokenBucket struct {
+	last       time.Time
+	tokens     float64
+	suppressed uint64
+	severity   Severity
+}
+
+// Creates a sampler that allows `rate` entries per second per message template, with bursts of
+// at most `burst` entries.
+func NewTokenBucketSampler(rate float64, burst int) *TokenBucketSampler {
+	return &TokenBucketSampler{
+		buckets: make(map[string]*tokenBucket),
+		rate:    rate,
+		burst:   float64(max(burst, 1)),
+	}
+}
+
+// Implements Sampler
+func (s *TokenBucketSampler) Sample(severity Severity, message string, now time.Time) (ok bool, suppressed uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, found := s.buckets[message]
+
+	if !found {
+		if len(s.buckets) >= MaxSamplerKeys {
+			for msg, b := range s.buckets {
+				s.pending = appendPending(s.pending, msg, b.severity, b.suppressed)
+			}
+
+			s.buckets = make(map[string]*tokenBucket)
+		}
+
+		b = &tokenBucket{tokens: s.burst, last: now}
+		s.buckets[message] = b
+	}
+
+	b.tokens = min(s.burst, b.tokens+now.Sub(b.last).Seconds()*s.rate)
+	b.last = now
+
+	if b.tokens < 1 {
+		b.suppressed++
+		b.severity = severity
+		return false, 0
+	}
+
+	b.tokens--
+	suppressed, b.suppressed = b.suppressed, 0
+	return true, suppressed
+}
+
+// Implements SamplerDrainer
+func (s *TokenBucketSampler) Drain() (suppressed []Suppressed) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	suppressed, s.pending = s.pending, nil
+
+	for msg, b := range s.buckets {
+		suppressed = appendSuppressed(suppressed, msg, b.severity, b.suppressed)
+		b.suppressed = 0
+	}
+
+	return
+}
+
+// Sends the first N entries per message template and interval, and then every Mth.
+type FirstThenEverySampler struct {
+	counters   map[string]*sampleCounter
+	pending    []Suppressed // Counts of reset counters
+	interval   time.Duration
+	first      uint64
+	thereafter uint64
+	mu         sync.Mutex
+}
+
+type sampleCounter struct {
+	reset      time.Time
+	count      uint64
+	suppressed uint64
+	severity   Severity
+}
+
+// Creates a sampler that sends the `first` entries per message template and interval, and then
+// every `thereafter` entry. If `thereafter` is zero, the rest of the interval is suppressed.
+func NewFirstThenEverySampler(first, thereafter int, interval time.Duration) *FirstThenEverySampler {
+	return &FirstThenEverySampler{
+		counters:   make(map[string]*sampleCounter),
+		interval:   interval,
+		first:      uint64(max(first, 0)),
+		thereafter: uint64(max(thereafter, 0)),
+	}
+}
+
+// Implements Sampler
+func (s *FirstThenEverySampler) Sample(severity Severity, message string, now time.Time) (ok bool, suppressed uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, found := s.counters[message]
+
+	if !found {
+		if len(s.counters) >= MaxSamplerKeys {
+			for msg, c := range s.counters {
+				s.pending = appendPending(s.pending, msg, c.severity, c.suppressed)
+			}
+
+			s.counters = make(map[string]*sampleCounter)
+		}
+
+		c = new(sampleCounter)
+		s.counters[message] = c
+	}
+
+	if !now.Before(c.reset) {
+		c.count = 0
+		c.reset = now.Add(s.interval)
+	}
+
+	c.count++
+
+	if c.count > s.first && (s.thereafter == 0 || (c.count-s.first)%s.thereafter != 0) {
+		c.suppressed++
+		c.severity = severity
+		return false, 0
+	}
+
+	suppressed, c.suppressed = c.suppressed, 0
+	return true, suppressed
+}
+
+// Implements SamplerDrainer
+func (s *FirstThenEverySampler) Drain() (suppressed []Suppressed) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	suppressed, s.pending = s.pending, nil
+
+	for msg, c := range s.counters {
+		suppressed = appendSuppressed(suppressed, msg, c.severity, c.suppressed)
+		c.suppressed = 0
+	}
+
+	return
+}
+
+// Sends entries with a probability per severity.
+type ProbabilitySampler struct {
+	rates      [DEBUG + 1]float64
+	suppressed [DEBUG + 1]uint64
+	mu         sync.Mutex
+}
+
+// Creates a sampler that sends entries with a probability (0-1) per severity, e.g. 0.01 for
+// DEBUG. Severities without a rate are always sent.
+func NewProbabilitySampler(rates map[Severity]float64) *ProbabilitySampler {
+	s := new(ProbabilitySampler)
+
+	for i := range s.rates {
+		s.rates[i] = 1
+	}
+
+	for severity, rate := range rates {
+		if severity <= DEBUG {
+			s.rates[severity] = rate
+		}
+	}
+
+	return s
+}
+
+// Implements Sampler
+func (s *ProbabilitySampler) Sample(severity Severity, _ string, _ time.Time) (ok bool, suppressed uint64) {
+	if severity > DEBUG {
+		return true, 0
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.rates[severity] < 1 && rand.Float64() >= s.rates[severity] {
+		s.suppressed[severity]++
+		return false, 0
+	}
+
+	suppressed, s.suppressed[severity] = s.suppressed[severity], 0
+	return true, suppressed
+}
+
+// Implements SamplerDrainer
+func (s *ProbabilitySampler) Drain() (suppressed []Suppressed) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for severity := range s.suppressed {
+		suppressed = appendSuppressed(suppressed, "", Severity(severity), s.suppressed[severity])
+		s.suppressed[severity] = 0
+	}
+
+	return
+}
+
+func appendSuppressed(suppressed []Suppressed, message string, severity Severity, count uint64) []Suppressed {
+	if count == 0 {
+		return suppressed
+	}
+
+	return append(suppressed, Suppressed{Message: message, Count: count, Severity: severity})
+}
+
+// Like `appendSuppressed`, but counts beyond `MaxSamplerKeys` templates are merged into the last
+// one, without message.
+func appendPending(pending []Suppressed, message string, severity Severity, count uint64) []Suppressed {
+	if count == 0 || len(pending) < MaxSamplerKeys {
+		return appendSuppressed(pending, message, severity, count)
+	}
+
+	last := &pending[len(pending)-1]
+	last.Message = ""
+	last.Count += count
+	last.Severity = min(last.Severity, severity)
+	return pending
+}
@@ -0,0 +1,258 @@
+//go:build go1.21
+
+package logger
+
+import (
+	"context"
+	"log/slog"
+	"runtime"
+
+	"github.com/rs/xid"
+)
+
+var _ slog.Handler = (*SlogHandler)(nil)
+
+type SlogOptions struct {
+	Level         slog.Leveler // Minimum level of records to handle. Default: slog.LevelInfo
+	TagKeys       []string     // Keys of attributes that become tags rather than meta, regardless of group, e.g. "user"
+	CategoryKey   string       // Key of an integer attribute that becomes the category ID, regardless of group
+	NumbersAsMeta bool         // Store numeric attributes as meta rather than metrics
+}
+
+func (opt *SlogOptions) setDefaults() {
+	if opt.Level == nil {
+		opt.Level = slog.LevelInfo
+	}
+}
+
+// A `slog.Handler` that sends records as entries through a logger. Attributes become meta,
+// metrics (numbers and durations), tags or category according to `SlogOptions`, and groups
+// prefix the keys of their attributes, e.g. "req.method".
+type SlogHandler struct {
+	logger  *Logger
+	opt     *SlogOptions
+	tagKeys map[string]struct{}
+	group   string
+}
+
+// Creates a `slog.Handler` backed by the logger, e.g. `slog.New(logger.NewSlogHandler(log))`.
+func NewSlogHandler(l *Logger, options ...SlogOptions) *SlogHandler {
+	var opt SlogOptions
+
+	if options != nil {
+		opt = options[0]
+	}
+
+	opt.setDefaults()
+
+	h := &SlogHandler{
+		logger:  l,
+		opt:     &opt,
+		tagKeys: make(map[string]struct{}, len(opt.TagKeys)),
+	}
+
+	for _, key := range opt.TagKeys {
+		h.tagKeys[key] = struct{}{}
+	}
+
+	return h
+}
+
+// Maps a slog level to a severity. Levels between the named slog levels map to the severities
+// between them, e.g. `slog.LevelInfo+2` is NOTICE and `slog.LevelError+4` is CRIT.
+func SlogLevelSeverity(level slog.Level) Severity {
+	switch {
+	case level < slog.LevelInfo:
+		return DEBUG
+	case level < slog.LevelInfo+2:
+		return INFO
+	case level < slog.LevelWarn:
+		return NOTICE
+	case level < slog.LevelError:
+		return WARNING
+	case level < slog.LevelError+4:
+		return ERR
+	case level < slog.LevelError+8:
+		return CRIT
+	case level < slog.LevelError+12:
+		return ALERT
+	}
+
+	return EMERG
+}
+
+// Implements slog.Handler
+func (h *SlogHandler) Enabled(_ context.Context, level slog.Level) bool {
+	if level < h.opt.Level.Level() {
+		return false
+	}
+
+	// Category rules can only enable records with a category attribute
+	ok, recheck := h.logger.admits(SlogLevelSeverity(level), nil)
+	return ok && (!recheck || h.opt.CategoryKey != "")
+}
+
+// Implements slog.Handler
+func (h *SlogHandler) Handle(ctx context.Context, r slog.Record) error {
+	l := h.logger
+	severity := SlogLevelSeverity(r.Level)
+
+	// Messages are templates with placeholders
+	message := EscapeMessage(r.Message)
+
+	if !l.sample(severity, message) {
+		return nil
+	}
+
+	e := l.entry(severity, message)
+
+	// The category might be set by an attribute, so level rules are consulted again when sent
+	e.recheck = !l.enabled(severity, nil)
+
+	if !r.Time.IsZero() {
+		e.id = xid.NewWithTime(r.Time)
+		e.setNanos(subSecond(r.Time, l.pool.opt.TimePrecision))
+	}
+
+	if ctx != nil {
+		if tc, ok := l.pool.opt.TraceExtractor(ctx); ok {
+			e.TraceContext(tc)
+		}
+	}
+
+	r.Attrs(func(a slog.Attr) bool {
+		h.addAttr(e, h.group, a)
+		return true
+	})
+
+	// Only the caller is known, so that's all we can record
+	if r.PC != 0 && !l.noTrace && (severity <= l.traceSeverity || l.traceCaller) {
+		frame, _ := runtime.CallersFrames([]uintptr{r.PC}).Next()
+		e.incLevel(_8_Stack_trace)
+		e.setStackFrame(0, frame.File, frame.Function, frame.Line, l.pool.opt.TrimStackTrace)
+		e.stackTraceCount = 1
+	}
+
+	e.Send()
+	return nil
+}
+
+// Implements slog.Handler. Returns a handler with a derived logger, that has the attributes as
+// tags, meta, metrics and category.
+func (h *SlogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+
+	// Collect the attributes in an entry, so that the same rules apply as when handling a record
+	var e Entry
+	e.Reset()
+
+	for _, a := range attrs {
+		h.addAttr(&e, h.group, a)
+	}
+
+	l := h.logger.Logger()
+
+	if e.categoryId != 0 {
+		l.Cat(e.categoryId)
+	}
+
+	for i := uint8(0); i < e.tagsCount; i++ {
+		l.Tag(e.tags[i])
+	}
+
+	for i := uint8(0); i < e.metricCount; i++ {
+		l.AddMetric(e.metricKeys[i], e.metricValues[i])
+	}
+
+	for i := uint8(0); i < e.metaCount; i++ {
+		l.Meta(e.metaKeys[i], e.metaValues[i])
+	}
+
+	h2 := *h
+	h2.logger = l
+	return &h2
+}
+
+// Implements slog.Handler
+func (h *SlogHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+
+	h2 := *h
+	h2.group = h.group + name + "."
+	return &h2
+}
+
+func (h *SlogHandler) addAttr(e *Entry, prefix string, a slog.Attr) {
+	a.Value = a.Value.Resolve()
+
+	// Empty attributes must be ignored
+	if a.Equal(slog.Attr{}) {
+		return
+	}
+
+	if a.Value.Kind() == slog.KindGroup {
+		// Groups without a key are inlined
+		if a.Key != "" {
+			prefix += a.Key + "."
+		}
+
+		for _, ga := range a.Value.Group() {
+			h.addAttr(e, prefix, ga)
+		}
+
+		return
+	}
+
+	if h.opt.CategoryKey != "" && a.Key == h.opt.CategoryKey {
+		switch a.Value.Kind() {
+		case slog.KindInt64:
+			if v := a.Value.Int64(); v >= 0 && v <= 255 {
+				e.Cat(uint8(v))
+				return
+			}
+
+		case slog.KindUint64:
+			if v := a.Value.Uint64(); v <= 255 {
+				e.Cat(uint8(v))
+				return
+			}
+		}
+	}
+
+	if _, ok := h.tagKeys[a.Key]; ok {
+		e.Tag(a.Value.String())
+		return
+	}
+
+	key := a.Key
+
+	if prefix != "" {
+		key = prefix + key
+	}
+
+	if !h.opt.NumbersAsMeta {
+		switch a.Value.Kind() {
+		case slog.KindInt64:
+			e.MetricInt(key, a.Value.Int64())
+			return
+
+		case slog.KindUint64:
+			e.MetricInt(key, int64(a.Value.Uint64()))
+			return
+
+		case slog.KindFloat64:
+			e.MetricFloat(key, a.Value.Float64())
+			return
+
+		case slog.KindDuration:
+			e.Timing(key, a.Value.Duration())
+			return
+		}
+	}
+
+	e.Meta(key, a.Value.String())
+}
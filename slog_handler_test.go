@@ -0,0 +1,83 @@
+//go:build go1.21
+
+package logger
+
+import (
+	"log/slog"
+	"testing"
+	"time"
+)
+
+func TestSlogHandler(t *testing.T) {
+	var rec entryRecorder
+	pool, err := NewPool(&rec, PoolOptions{TraceCaller: true})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	log := slog.New(NewSlogHandler(pool.Logger(), SlogOptions{
+		TagKeys:     []string{"user"},
+		CategoryKey: "cat",
+	})).With("cat", 3, "service", "api")
+
+	log.WithGroup("req").Warn("slow request at 100%", "user", "alice", "method", "GET", "took", 1500*time.Millisecond, "size", 42)
+	log.Debug("ignored")
+
+	if len(rec.entries) != 1 {
+		t.Fatalf("expected 1 entry, got %d", len(rec.entries))
+	}
+
+	e := rec.entries[0]
+	r := e.Read()
+
+	if r.Sev() != WARNING || r.Cat() != 3 || e.String() != "slow request at 100%" {
+		t.Errorf("unexpected entry: %s (severity %d, category %d)", e, r.Sev(), r.Cat())
+	}
+
+	if tags := r.Tags(); len(tags) != 1 || tags[0] != "alice" {
+		t.Errorf("expected user as tag, got %v", tags)
+	}
+
+	keys, values := r.Meta()
+
+	if len(keys) != 2 || keys[0] != "req.method" || values[0] != "GET" || keys[1] != "service" {
+		t.Errorf("unexpected meta: %v = %v", keys, values)
+	}
+
+	metricKeys, metrics := r.Metrics()
+
+	if len(metricKeys) != 2 || metricKeys[0] != "req.took" || metrics[0].Kind != MetricTiming || metricKeys[1] != "req.size" || metrics[1].Int != 42 {
+		t.Errorf("unexpected metrics: %v = %v", metricKeys, metrics)
+	}
+
+	if _, _, funcs := r.Trace(); len(funcs) != 1 || funcs[0] != "github.com/webbmaffian/go-logger.TestSlogHandler" {
+		t.Errorf("expected caller frame, got %v", funcs)
+	}
+}
+
+func TestSlogHandlerWithAttrs(t *testing.T) {
+	var rec entryRecorder
+	pool, err := NewPool(&rec)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A recycled entry must not leak its category into derived loggers
+	e := pool.Entry()
+	e.Cat(9)
+	pool.ReleaseEntry(e)
+
+	log := slog.New(NewSlogHandler(pool.Logger()))
+	log.With("service", "api").Info("started")
+
+	// Without a category key, attributes with an empty key aren't categories
+	log.With("", 4).Info("started")
+
+	for i, e := range rec.entries {
+		if cat := e.Read().Cat(); cat != 0 {
+			t.Errorf("entry %d: expected no category, got %d", i, cat)
+		}
+	}
+}
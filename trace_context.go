@@ -0,0 +1,121 @@
+package logger
+
+import (
+	"context"
+	"encoding/hex"
+)
+
+// W3C trace ID.
+type TraceId [16]byte
+
+func (id TraceId) IsZero() bool {
+	return id == TraceId{}
+}
+
+// Implements stringer interface
+func (id TraceId) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+// W3C span ID (a.k.a. parent ID).
+type SpanId [8]byte
+
+func (id SpanId) IsZero() bool {
+	return id == SpanId{}
+}
+
+// Implements stringer interface
+func (id SpanId) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+// Trace context, compatible with the W3C `traceparent` header.
+type TraceContext struct {
+	TraceId TraceId
+	SpanId  SpanId
+	Flags   uint8
+}
+
+func (tc TraceContext) IsZero() bool {
+	return tc.TraceId.IsZero() && tc.SpanId.IsZero()
+}
+
+func (tc TraceContext) Sampled() bool {
+	return tc.Flags&0x01 != 0
+}
+
+// Returns the trace context as a W3C `traceparent` header value, e.g.
+// `00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01`.
+func (tc TraceContext) Traceparent() string {
+	var b [55]byte
+	b[0], b[1], b[2] = '0', '0', '-'
+	hex.Encode(b[3:35], tc.TraceId[:])
+	b[35] = '-'
+	hex.Encode(b[36:52], tc.SpanId[:])
+	b[52] = '-'
+	hex.Encode(b[53:55], []byte{tc.Flags})
+	return string(b[:])
+}
+
+// Parses a W3C `traceparent` header value.
+func ParseTraceparent(s string) (tc TraceContext, err error) {
+	// Future versions may append fields, but never change the existing ones
+	if len(s) < 55 || s[2] != '-' || s[35] != '-' || s[52] != '-' || (len(s) > 55 && s[55] != '-') {
+		return tc, ErrInvalidTraceparent
+	}
+
+	// Hex digits must be lowercase
+	for i := 0; i < 55; i++ {
+		if s[i] >= 'A' && s[i] <= 'F' {
+			return tc, ErrInvalidTraceparent
+		}
+	}
+
+	var version [1]byte
+
+	if _, err = hex.Decode(version[:], []byte(s[0:2])); err != nil || version[0] == 0xff {
+		return tc, ErrInvalidTraceparent
+	}
+
+	if version[0] == 0 && len(s) != 55 {
+		return tc, ErrInvalidTraceparent
+	}
+
+	if _, err = hex.Decode(tc.TraceId[:], []byte(s[3:35])); err != nil {
+		return tc, ErrInvalidTraceparent
+	}
+
+	if _, err = hex.Decode(tc.SpanId[:], []byte(s[36:52])); err != nil {
+		return tc, ErrInvalidTraceparent
+	}
+
+	var flags [1]byte
+
+	if _, err = hex.Decode(flags[:], []byte(s[53:55])); err != nil {
+		return tc, ErrInvalidTraceparent
+	}
+
+	tc.Flags = flags[0]
+
+	if tc.TraceId.IsZero() || tc.SpanId.IsZero() {
+		return TraceContext{}, ErrInvalidTraceparent
+	}
+
+	return
+}
+
+// Extracts a trace context from a context, e.g. from an OpenTelemetry span.
+type TraceExtractor func(ctx context.Context) (tc TraceContext, ok bool)
+
+type traceContextKey struct{}
+
+// Returns a copy of the context carrying a trace context, which will be picked up by `Logger.Ctx`.
+func ContextWithTrace(ctx context.Context, tc TraceContext) context.Context {
+	return context.WithValue(ctx, traceContextKey{}, tc)
+}
+
+// Returns the trace context carried by the context, if any.
+func TraceFromContext(ctx context.Context) (tc TraceContext, ok bool) {
+	tc, ok = ctx.Value(traceContextKey{}).(TraceContext)
+	return
+}
@@ -4,23 +4,38 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"unicode/utf8"
 )
 
 var regexErrorString = regexp.MustCompile(`('[^']+')|([0-9]+\.?[0-9]*)`)
 
 func parseErrorString(e *Entry, str string) {
+	var (
+		b    strings.Builder
+		last int
+	)
+
 	e.tagsCount = 0
+	e.incLevel(_5_Tags)
+
+	// Values become tags, and the rest is escaped so that it's rendered as is
+	for _, m := range regexErrorString.FindAllStringIndex(str, -1) {
+		s := str[m[0]:m[1]]
 
-	e.message = truncate(regexErrorString.ReplaceAllStringFunc(str, func(s string) string {
 		if len(s) > 32 || e.tagsCount >= 8 {
-			return s
+			continue
 		}
 
+		b.WriteString(EscapeMessage(str[last:m[0]]))
+		b.WriteString("%s")
+		last = m[1]
+
 		e.tags[e.tagsCount] = strings.Trim(s, "'. ")
 		e.tagsCount++
+	}
 
-		return "%s"
-	}), MaxMessageSize)
+	b.WriteString(EscapeMessage(str[last:]))
+	e.message = e.truncate(b.String(), MaxMessageSize, TruncatedMessage)
 }
 
 func max[T ~uint8 | ~uint16 | ~uint32 | ~uint64 | ~int8 | ~int16 | ~int32 | ~int64 | ~int | ~uint | ~float32 | ~float64](a, b T) T {
@@ -39,12 +54,58 @@ func min[T ~uint8 | ~uint16 | ~uint32 | ~uint64 | ~int8 | ~int16 | ~int32 | ~int
 	return b
 }
 
+// Replaces the directory of a source file with the import path of its package, and strips the
+// package path from the function name, e.g. "/home/me/go/pkg/mod/github.com/foo/bar@v1.2.3/baz/qux.go"
+// and "github.com/foo/bar/baz.(*Qux).Run" becomes "github.com/foo/bar/baz/qux.go" and "(*Qux).Run".
+// Files in the main package have no import path, so their paths are kept, but "main." is still
+// stripped from their function names.
+func trimStackFrame(path, function string) (string, string) {
+	slash := strings.LastIndexByte(function, '/')
+	dot := strings.IndexByte(function[slash+1:], '.')
+
+	if dot < 0 {
+		return path, function
+	}
+
+	pkg := function[:slash+1+dot]
+	function = function[slash+2+dot:]
+
+	if pkg == "main" {
+		return path, function
+	}
+
+	if i := strings.LastIndexByte(path, '/'); i >= 0 {
+		path = pkg + path[i:]
+	}
+
+	return path, function
+}
+
+// Truncates a string to a max length in bytes, without cutting a multi-byte UTF-8 character in half.
 func truncate(str string, length int) string {
-	if len(str) > length {
-		return str[:length]
+	if len(str) <= length {
+		return str
+	}
+
+	for length > 0 && !utf8.RuneStart(str[length]) {
+		length--
+	}
+
+	return str[:length]
+}
+
+// Truncates a string like `truncate`, and appends a marker (e.g. an ellipsis) within the max
+// length to any truncated string. The marker is skipped if it doesn't fit.
+func truncateMarked(str string, length int, marker string) string {
+	if len(str) <= length {
+		return str
+	}
+
+	if marker == "" || len(marker) >= length {
+		return truncate(str, length)
 	}
 
-	return str
+	return truncate(str, length-len(marker)) + marker
 }
 
 type stringer interface {
@@ -49,3 +49,45 @@ func BenchmarkFormatInt(b *testing.B) {
 		}
 	})
 }
+
+func TestTrimStackFrame(t *testing.T) {
+	tests := []struct {
+		path, function, expPath, expFunction string
+	}{
+		{"/home/me/go/pkg/mod/github.com/foo/bar@v1.2.3/baz/qux.go", "github.com/foo/bar/baz.(*Qux).Run", "github.com/foo/bar/baz/qux.go", "(*Qux).Run"},
+		{"/usr/local/go/src/net/http/server.go", "net/http.(*conn).serve", "net/http/server.go", "(*conn).serve"},
+		{"/usr/local/go/src/runtime/proc.go", "runtime.main", "runtime/proc.go", "main"},
+		{"/home/me/app/main.go", "main.main.func1", "/home/me/app/main.go", "main.func1"},
+		{"/home/me/app/server.go", "main.(*server).ServeHTTP", "/home/me/app/server.go", "(*server).ServeHTTP"},
+		{"unknown.go", "unknown", "unknown.go", "unknown"},
+	}
+
+	for _, test := range tests {
+		path, function := trimStackFrame(test.path, test.function)
+
+		if path != test.expPath || function != test.expFunction {
+			t.Errorf("trimStackFrame(%q, %q) = %q, %q; expected %q, %q", test.path, test.function, path, function, test.expPath, test.expFunction)
+		}
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		str, marker, expected string
+		length                int
+	}{
+		{"räksmörgås", "", "räksmörgås", 13},
+		{"räksmörgås", "", "räksm", 6},
+		{"räksmörgås", "", "räksm", 7},
+		{"räksmörgås", "", "räksmö", 8},
+		{"räksmörgås", "…", "räks…", 8},
+		{"räksmörgås", "…", "rä", 3},
+		{"ö", "", "", 1},
+	}
+
+	for _, test := range tests {
+		if got := truncateMarked(test.str, test.length, test.marker); got != test.expected {
+			t.Errorf("expected %q, got %q", test.expected, got)
+		}
+	}
+}
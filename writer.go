@@ -0,0 +1,223 @@
+package logger
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+var _ io.Writer = (*Writer)(nil)
+
+type WriterOptions struct {
+	Severity       Severity // Severity of lines without a detected severity. Default: INFO
+	DetectSeverity bool     // Detect severity from prefixes like "ERROR:", "[warn]" or "panic:"
+	Multiline      bool     // Group lines starting with whitespace (e.g. stack traces) with the preceding line
+	MaxLineSize    int      // Incomplete lines longer than this are sent in parts, e.g. if a newline never comes. Default: MaxEntrySize
+}
+
+func (opt *WriterOptions) setDefaults() {
+	// An unset severity can't be told apart from EMERG, which plain output of a library hardly
+	// deserves - so EMERG has to be detected from a prefix
+	if opt.Severity == 0 {
+		opt.Severity = INFO
+	}
+
+	if opt.MaxLineSize <= 0 {
+		opt.MaxLineSize = MaxEntrySize
+	}
+}
+
+// An `io.Writer` that sends each line as an entry, e.g. for libraries that log to an `io.Writer`
+// or a `*log.Logger`. With `WriterOptions.Multiline`, lines starting with whitespace are sent
+// in the same entry as the line before, as long as they're written in the same call.
+type Writer struct {
+	logger  *Logger
+	opt     WriterOptions
+	buf     []byte // Incomplete line, awaiting its newline
+	line    []byte // Pending line
+	group   []byte // Continuation lines of the pending line
+	mu      sync.Mutex
+	pending bool
+}
+
+// Creates a writer that sends each line as an entry through the logger.
+func NewWriter(l *Logger, options ...WriterOptions) *Writer {
+	var opt WriterOptions
+
+	if options != nil {
+		opt = options[0]
+	}
+
+	opt.setDefaults()
+
+	return &Writer{
+		logger: l,
+		opt:    opt,
+	}
+}
+
+// Creates a `*log.Logger` that sends each message as an entry through the logger, e.g. for
+// `http.Server.ErrorLog`. Messages are grouped (see `WriterOptions.Multiline`) and have their
+// severity detected unless options are passed.
+func NewStdLogger(l *Logger, options ...WriterOptions) *log.Logger {
+	if options == nil {
+		options = []WriterOptions{{DetectSeverity: true, Multiline: true}}
+	}
+
+	return log.New(NewWriter(l, options...), "", 0)
+}
+
+// Implements io.Writer. Never fails, as entries are sent asynchronously.
+func (w *Writer) Write(p []byte) (n int, err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var start int
+	n = len(p)
+	w.buf = append(w.buf, p...)
+
+	for {
+		i := bytes.IndexByte(w.buf[start:], '\n')
+
+		if i < 0 {
+			break
+		}
+
+		w.addLine(bytes.TrimRight(w.buf[start:start+i], "\r"))
+		start += i + 1
+	}
+
+	// Send incomplete lines that have grown too long in parts, without splitting any character
+	for len(w.buf)-start > w.opt.MaxLineSize {
+		size := w.opt.MaxLineSize
+
+		for i := size; i > 0 && i > size-utf8.UTFMax; i-- {
+			if utf8.RuneStart(w.buf[start+i]) {
+				size = i
+				break
+			}
+		}
+
+		w.addLine(w.buf[start : start+size])
+		start += size
+	}
+
+	// Keep any incomplete line at the start of the buffer
+	w.buf = append(w.buf[:0], w.buf[start:]...)
+	w.sendPending()
+	return
+}
+
+// Sends any incomplete line that is still awaiting its newline.
+func (w *Writer) Flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if len(w.buf) != 0 {
+		w.addLine(w.buf)
+		w.buf = w.buf[:0]
+	}
+
+	w.sendPending()
+}
+
+func (w *Writer) addLine(line []byte) {
+	if w.opt.Multiline && w.pending && len(line) != 0 && (line[0] == ' ' || line[0] == '\t') {
+		w.group = append(w.group, line...)
+		w.group = append(w.group, '\n')
+		return
+	}
+
+	w.sendPending()
+
+	if len(bytes.TrimSpace(line)) != 0 {
+		w.line = append(w.line[:0], line...)
+		w.pending = true
+	}
+}
+
+func (w *Writer) sendPending() {
+	if !w.pending {
+		return
+	}
+
+	line := string(w.line)
+	severity := w.opt.Severity
+
+	if w.opt.DetectSeverity {
+		if sev, ok := detectSeverity(line); ok {
+			severity = sev
+		}
+	}
+
+	if !w.logger.Enabled(severity) {
+		w.pending = false
+		w.group = w.group[:0]
+		return
+	}
+
+	// Messages are templates with placeholders
+	line = EscapeMessage(line)
+
+	if !w.logger.sample(severity, line) {
+		w.pending = false
+		w.group = w.group[:0]
+		return
+	}
+
+	e := w.logger.entry(severity, line)
+
+	if len(w.group) != 0 {
+		e.MetaBlob(string(bytes.TrimRight(w.group, "\n")))
+	}
+
+	e.Send()
+	w.pending = false
+	w.group = w.group[:0]
+}
+
+var severityPrefixes = [...]struct {
+	prefix   string
+	severity Severity
+}{
+	{"emergency", EMERG},
+	{"emerg", EMERG},
+	{"alert", ALERT},
+	{"critical", CRIT},
+	{"crit", CRIT},
+	{"fatal", CRIT},
+	{"panic", CRIT},
+	{"error", ERR},
+	{"err", ERR},
+	{"warning", WARNING},
+	{"warn", WARNING},
+	{"notice", NOTICE},
+	{"info", INFO},
+	{"debug", DEBUG},
+	{"trace", DEBUG},
+}
+
+// Detects the severity from a prefix of a line, e.g. "ERROR: ...", "[warn] ..." or "panic: ...".
+func detectSeverity(line string) (Severity, bool) {
+	line = strings.TrimLeft(line, " \t[<")
+
+	for _, p := range severityPrefixes {
+		if len(line) < len(p.prefix) || !strings.EqualFold(line[:len(p.prefix)], p.prefix) {
+			continue
+		}
+
+		// The prefix must be a whole word
+		if len(line) == len(p.prefix) || !isLetter(line[len(p.prefix)]) {
+			return p.severity, true
+		}
+	}
+
+	return 0, false
+}
+
+func isLetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
@@ -0,0 +1,37 @@
+package logger
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWriterLongLines(t *testing.T) {
+	var rec entryRecorder
+	pool, err := NewPool(&rec)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := NewWriter(pool.Logger(), WriterOptions{MaxLineSize: 10})
+
+	// Incomplete lines are sent in parts once too long, without splitting characters
+	for i := 0; i < 3; i++ {
+		w.Write([]byte("åäö åäö "))
+	}
+
+	if len(w.buf) > 10 {
+		t.Errorf("expected incomplete line to be capped, got %d bytes", len(w.buf))
+	}
+
+	w.Write([]byte("end\n"))
+	var parts []string
+
+	for _, e := range rec.entries {
+		parts = append(parts, e.Read().Msg())
+	}
+
+	if strings.Join(parts, "") != strings.Repeat("åäö åäö ", 3)+"end" || parts[0] != "åäö å" {
+		t.Errorf("unexpected parts: %q", parts)
+	}
+}